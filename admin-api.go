@@ -3,20 +3,28 @@ package main
 import (
 	"encoding/json"
 	"net/http"
-
-	"github.com/IBM/sarama"
 )
 
 func (s *Server) ServeKafkaMetrics(w http.ResponseWriter, r *http.Request) {
 
-	brokers := s.kafkaConn.Brokers() 
+	brokers, err := s.source.ListBrokers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	brokerIDs := make([]int32, len(brokers))
-	for i, broker := range brokers { 
-		brokerIDs[i] = broker.ID()
+	for i, broker := range brokers {
+		brokerIDs[i] = broker.ID
 	}
 
 
-	topics, err := s.kafkaConn.Topics()
+	topics, err := s.source.ListTopics()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	metadata, err := s.source.DescribeTopics(topics)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -24,55 +32,25 @@ func (s *Server) ServeKafkaMetrics(w http.ResponseWriter, r *http.Request) {
 
 
 	topicDetails := make(map[string]interface{})
-	for _, topic := range topics {
-		partitions, err := s.kafkaConn.Partitions(topic)
+	for _, topic := range metadata {
+		offsets, err := s.source.PartitionOffsets(topic.Name)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		partitionDetails := make(map[int32]interface{})
-		for _, partition := range partitions {
-			offsetNewest, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetNewest)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			offsetOldest, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetOldest)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			leader, err := s.kafkaConn.Leader(topic, partition)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			replicas, err := s.kafkaConn.Replicas(topic, partition)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			isr, err := s.kafkaConn.InSyncReplicas(topic, partition)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			partitionDetails[partition] = map[string]interface{}{
-				"offsetNewest": offsetNewest,
-				"offsetOldest": offsetOldest,
-				"leader":       leader.ID(),
-				"replicas":     replicas,
-				"isr":          isr,
+		for _, partition := range topic.Partitions {
+			partitionDetails[partition.ID] = map[string]interface{}{
+				"offsetNewest": offsets[partition.ID].Newest,
+				"offsetOldest": offsets[partition.ID].Oldest,
+				"leader":       partition.Leader,
+				"replicas":     partition.Replicas,
+				"isr":          partition.ISR,
 			}
 		}
 
-		topicDetails[topic] = partitionDetails
+		topicDetails[topic.Name] = partitionDetails
 	}
 
 
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umerfarok/kafka-live-dashboard/config"
+)
+
+const clusterReconnectInterval = 30 * time.Second
+
+// ClusterRegistry owns one Server per configured cluster. Each cluster
+// connects independently, so an unreachable cluster only affects its own
+// routes.
+type ClusterRegistry struct {
+	mu       sync.RWMutex
+	clusters map[string]*clusterEntry
+	order    []string
+}
+
+type clusterEntry struct {
+	cluster config.ClusterConfig
+	config  *config.Config
+	server  *Server
+	err     error
+}
+
+type ClusterHealth struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Brokers     string    `json:"brokers"`
+	Connected   bool      `json:"connected"`
+	Healthy     bool      `json:"healthy"`
+	Error       string    `json:"error,omitempty"`
+	BrokerCount int       `json:"brokerCount"`
+	TopicCount  int       `json:"topicCount"`
+	LastUpdated time.Time `json:"lastUpdated"`
+	Stale       bool      `json:"stale"`
+}
+
+func NewClusterRegistry(cfg *config.Config) *ClusterRegistry {
+	registry := &ClusterRegistry{
+		clusters: make(map[string]*clusterEntry),
+	}
+
+	for _, cluster := range cfg.Clusters {
+		registry.clusters[cluster.ID] = &clusterEntry{
+			cluster: cluster,
+			config:  cfg.ForCluster(cluster),
+			err:     fmt.Errorf("connecting"),
+		}
+		registry.order = append(registry.order, cluster.ID)
+	}
+
+	return registry
+}
+
+// Start connects to every cluster in the background, retrying failed
+// clusters until they become reachable.
+func (c *ClusterRegistry) Start() {
+	for _, id := range c.order {
+		go c.connect(c.clusters[id])
+	}
+}
+
+func (c *ClusterRegistry) connect(entry *clusterEntry) {
+	for {
+		server, err := NewServer(entry.config)
+		if err == nil {
+			c.mu.Lock()
+			entry.server = server
+			entry.err = nil
+			c.mu.Unlock()
+
+			log.Printf("Connected to cluster %s", entry.cluster.ID)
+			server.Run()
+			return
+		}
+
+		log.Printf("Failed to connect to cluster %s: %v", entry.cluster.ID, err)
+		c.mu.Lock()
+		entry.err = err
+		c.mu.Unlock()
+
+		time.Sleep(clusterReconnectInterval)
+	}
+}
+
+// Server returns the connected server for a cluster, or the reason it is
+// not available.
+func (c *ClusterRegistry) Server(id string) (*Server, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.clusters[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster %s", id)
+	}
+	if entry.server == nil {
+		return nil, entry.err
+	}
+	return entry.server, nil
+}
+
+// DefaultServer returns the first configured cluster, which also serves the
+// unprefixed legacy routes.
+func (c *ClusterRegistry) DefaultServer() (*Server, error) {
+	return c.Server(c.order[0])
+}
+
+func (c *ClusterRegistry) Health() []ClusterHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	health := make([]ClusterHealth, 0, len(c.order))
+	for _, id := range c.order {
+		entry := c.clusters[id]
+		h := ClusterHealth{
+			ID:      entry.cluster.ID,
+			Name:    entry.cluster.Name,
+			Brokers: entry.cluster.Brokers,
+		}
+
+		if entry.server == nil {
+			h.Error = entry.err.Error()
+			h.Stale = true
+		} else {
+			h.Connected = true
+			status := entry.server.clusterStatus.Load()
+			if status != nil {
+				h.BrokerCount = len(status.Brokers)
+				h.TopicCount = status.TotalTopics
+				h.LastUpdated = status.LastUpdated
+			}
+			current := entry.server.snapshotClusterStatus()
+			h.Stale = current.Stale
+			h.Error = current.LastError
+			h.Healthy = status != nil && !current.Stale
+		}
+
+		health = append(health, h)
+	}
+
+	return health
+}
+
+func (c *ClusterRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/clusters" && r.Method == "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Health())
+	case strings.HasPrefix(r.URL.Path, "/clusters/"):
+		rest := strings.TrimPrefix(r.URL.Path, "/clusters/")
+		id, path, _ := strings.Cut(rest, "/")
+
+		server, err := c.Server(id)
+		if err != nil {
+			if _, ok := c.clusters[id]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Cluster %s is unavailable: %v", id, err), http.StatusServiceUnavailable)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + path
+		r2.URL.RawPath = ""
+		server.ServeHTTP(w, r2)
+	default:
+		server, err := c.DefaultServer()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Cluster %s is unavailable: %v", c.order[0], err), http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultClusterID names the single cluster configured through environment
+// variables when no CLUSTERS_FILE is given.
+const DefaultClusterID = "default"
+
+// ClusterConfig describes one Kafka cluster in the registry file.
+type ClusterConfig struct {
+	ID             string               `mapstructure:"id"`
+	Name           string               `mapstructure:"name"`
+	Brokers        string               `mapstructure:"brokers"`
+	MetadataSource string               `mapstructure:"metadataSource"`
+	ZookeeperNodes string               `mapstructure:"zookeeper"`
+	SASL           SASLConfig           `mapstructure:"sasl"`
+	TLS            TLSConfig            `mapstructure:"tls"`
+	SchemaRegistry SchemaRegistryConfig `mapstructure:"schemaRegistry"`
+	SchemaDir      string               `mapstructure:"schemaDir"`
+}
+
+type SASLConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+	Mechanism string `mapstructure:"mechanism"`
+}
+
+type TLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"caFile"`
+	CertFile           string `mapstructure:"certFile"`
+	KeyFile            string `mapstructure:"keyFile"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+}
+
+type SchemaRegistryConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+var clusterIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ForCluster returns a copy of c with the connection settings replaced by
+// those of cluster, so a Server can be built for it unchanged.
+func (c *Config) ForCluster(cluster ClusterConfig) *Config {
+	cfg := *c
+	cfg.ClusterID = cluster.ID
+	cfg.KafkaBrokers = cluster.Brokers
+	cfg.ZookeeperNodes = cluster.ZookeeperNodes
+	cfg.MetadataSource = cluster.MetadataSource
+	if cfg.MetadataSource == "" {
+		cfg.MetadataSource = "kafka"
+	}
+	cfg.UseSASL = cluster.SASL.Enabled
+	cfg.KafkaUsername = cluster.SASL.Username
+	cfg.KafkaPassword = cluster.SASL.Password
+	cfg.SASLMechanism = cluster.SASL.Mechanism
+	cfg.TLSEnabled = cluster.TLS.Enabled
+	cfg.TLSCAFile = cluster.TLS.CAFile
+	cfg.TLSCertFile = cluster.TLS.CertFile
+	cfg.TLSKeyFile = cluster.TLS.KeyFile
+	cfg.TLSInsecureSkipVerify = cluster.TLS.InsecureSkipVerify
+	cfg.SchemaRegistryURL = cluster.SchemaRegistry.URL
+	cfg.SchemaRegistryUsername = cluster.SchemaRegistry.Username
+	cfg.SchemaRegistryPassword = cluster.SchemaRegistry.Password
+	cfg.SchemaDir = cluster.SchemaDir
+	cfg.Clusters = nil
+	return &cfg
+}
+
+// loadClusters reads the cluster registry from CLUSTERS_FILE, or falls back
+// to a single cluster described by the environment.
+func loadClusters(c *Config) ([]ClusterConfig, error) {
+	if c.ClustersFile == "" {
+		return []ClusterConfig{{
+			ID:             DefaultClusterID,
+			Name:           DefaultClusterID,
+			Brokers:        c.KafkaBrokers,
+			MetadataSource: c.MetadataSource,
+			ZookeeperNodes: c.ZookeeperNodes,
+			SASL: SASLConfig{
+				Enabled:   c.UseSASL,
+				Username:  c.KafkaUsername,
+				Password:  c.KafkaPassword,
+				Mechanism: c.SASLMechanism,
+			},
+			TLS: TLSConfig{
+				Enabled:            c.TLSEnabled,
+				CAFile:             c.TLSCAFile,
+				CertFile:           c.TLSCertFile,
+				KeyFile:            c.TLSKeyFile,
+				InsecureSkipVerify: c.TLSInsecureSkipVerify,
+			},
+			SchemaRegistry: SchemaRegistryConfig{
+				URL:      c.SchemaRegistryURL,
+				Username: c.SchemaRegistryUsername,
+				Password: c.SchemaRegistryPassword,
+			},
+			SchemaDir: c.SchemaDir,
+		}}, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(c.ClustersFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read clusters file %s: %w", c.ClustersFile, err)
+	}
+
+	var clusters []ClusterConfig
+	if err := v.UnmarshalKey("clusters", &clusters); err != nil {
+		return nil, fmt.Errorf("failed to parse clusters file %s: %w", c.ClustersFile, err)
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("clusters file %s defines no clusters", c.ClustersFile)
+	}
+
+	seen := make(map[string]bool)
+	for i, cluster := range clusters {
+		if !clusterIDPattern.MatchString(cluster.ID) {
+			return nil, fmt.Errorf("cluster %d has invalid id %q", i, cluster.ID)
+		}
+		if seen[cluster.ID] {
+			return nil, fmt.Errorf("duplicate cluster id %q", cluster.ID)
+		}
+		seen[cluster.ID] = true
+
+		if cluster.Brokers == "" {
+			return nil, fmt.Errorf("cluster %q has no brokers", cluster.ID)
+		}
+		if cluster.Name == "" {
+			clusters[i].Name = cluster.ID
+		}
+	}
+
+	return clusters, nil
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -17,6 +19,20 @@ type Config struct {
 	HTTPWriteTimeout  int
 	HTTPIdleTimeout   int
 	ZookeeperNodes    string
+	MetadataSource    string
+	MetadataRefreshInterval int
+	MetadataStaleAfter      int
+	OffsetSampleInterval    int
+	ActiveWindow            int
+	HistoryDir              string
+	HistoryResolutionSeconds int
+	HistoryRetentionHours   int
+	HistoryPartitionOffsets bool
+	ExportDir               string
+	GroupCacheTTL           int
+	GroupWorkers            int
+	GroupPollInterval       int
+	ClusterID         string
 	CreateTestTopic   bool
 	AWSRegion         string
 	AWSAccessKeyID    string
@@ -24,6 +40,34 @@ type Config struct {
 	KafkaUsername     string
 	KafkaPassword     string
 	UseSASL           bool
+	SASLMechanism     string
+	TLSEnabled        bool
+	TLSCAFile         string
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSInsecureSkipVerify bool
+	SchemaRegistryURL      string
+	SchemaRegistryUsername string
+	SchemaRegistryPassword string
+	SchemaDir              string
+	ClustersFile      string
+	Clusters          []ClusterConfig
+}
+
+// UseZookeeper reports whether cluster metadata should be read from the
+// legacy ZooKeeper znodes instead of the Kafka protocol.
+func (c *Config) UseZookeeper() bool {
+	return strings.EqualFold(c.MetadataSource, "zookeeper")
+}
+
+// HistoryResolution is the finest step at which metric history is kept.
+func (c *Config) HistoryResolution() time.Duration {
+	return time.Duration(c.HistoryResolutionSeconds) * time.Second
+}
+
+// HistoryRetention is how long metric history is kept before it expires.
+func (c *Config) HistoryRetention() time.Duration {
+	return time.Duration(c.HistoryRetentionHours) * time.Hour
 }
 
 func NewConfig() (*Config, error) {
@@ -40,6 +84,19 @@ func NewConfig() (*Config, error) {
 	viper.SetDefault("KAFKA_GROUP_ID", "test-group")
 	viper.SetDefault("KAFKA_OFFSET", "latest")
 	viper.SetDefault("ZOOKEEPER_NODES", "localhost:2181")
+	viper.SetDefault("METADATA_SOURCE", "kafka")
+	viper.SetDefault("METADATA_REFRESH_INTERVAL", 30)
+	viper.SetDefault("METADATA_STALE_AFTER", 90)
+	viper.SetDefault("OFFSET_SAMPLE_INTERVAL", 10)
+	viper.SetDefault("ACTIVE_WINDOW", 60)
+	viper.SetDefault("HISTORY_DIR", "data/history")
+	viper.SetDefault("HISTORY_RESOLUTION", 10)
+	viper.SetDefault("HISTORY_RETENTION", 168)
+	viper.SetDefault("HISTORY_PARTITION_OFFSETS", false)
+	viper.SetDefault("EXPORT_DIR", "data/exports")
+	viper.SetDefault("GROUP_CACHE_TTL", 10)
+	viper.SetDefault("GROUP_WORKERS", 8)
+	viper.SetDefault("GROUP_POLL_INTERVAL", 5)
 	viper.SetDefault("CREATE_TEST_TOPIC", true)
 	viper.SetDefault("AWS_REGION", "")
 	viper.SetDefault("AWS_ACCESS_KEY_ID", "")
@@ -47,10 +104,21 @@ func NewConfig() (*Config, error) {
 	viper.SetDefault("KAFKA_USERNAME", "")
 	viper.SetDefault("KAFKA_PASSWORD", "")
 	viper.SetDefault("USE_SASL", false)
+	viper.SetDefault("KAFKA_SASL_MECHANISM", "PLAIN")
+	viper.SetDefault("KAFKA_TLS_ENABLED", false)
+	viper.SetDefault("KAFKA_TLS_CA_FILE", "")
+	viper.SetDefault("KAFKA_TLS_CERT_FILE", "")
+	viper.SetDefault("KAFKA_TLS_KEY_FILE", "")
+	viper.SetDefault("KAFKA_TLS_INSECURE_SKIP_VERIFY", false)
+	viper.SetDefault("SCHEMA_REGISTRY_URL", "")
+	viper.SetDefault("SCHEMA_REGISTRY_USERNAME", "")
+	viper.SetDefault("SCHEMA_REGISTRY_PASSWORD", "")
+	viper.SetDefault("SCHEMA_DIR", "")
+	viper.SetDefault("CLUSTERS_FILE", "")
 
 	viper.AutomaticEnv()
 
-	return &Config{
+	cfg := &Config{
 		KafkaBrokers:      viper.GetString("KAFKA_BROKERS"),
 		KafkaTopic:        viper.GetString("KAFKA_TOPIC"),
 		KafkaGroupID:      viper.GetString("KAFKA_GROUP_ID"),
@@ -60,6 +128,20 @@ func NewConfig() (*Config, error) {
 		HTTPWriteTimeout:  viper.GetInt("HTTP_WRITE_TIMEOUT"),
 		HTTPIdleTimeout:   viper.GetInt("HTTP_IDLE_TIMEOUT"),
 		ZookeeperNodes:    viper.GetString("ZOOKEEPER_NODES"),
+		MetadataSource:    viper.GetString("METADATA_SOURCE"),
+		MetadataRefreshInterval: viper.GetInt("METADATA_REFRESH_INTERVAL"),
+		MetadataStaleAfter:      viper.GetInt("METADATA_STALE_AFTER"),
+		OffsetSampleInterval:    viper.GetInt("OFFSET_SAMPLE_INTERVAL"),
+		ActiveWindow:            viper.GetInt("ACTIVE_WINDOW"),
+		HistoryDir:              viper.GetString("HISTORY_DIR"),
+		HistoryResolutionSeconds: viper.GetInt("HISTORY_RESOLUTION"),
+		HistoryRetentionHours:   viper.GetInt("HISTORY_RETENTION"),
+		HistoryPartitionOffsets: viper.GetBool("HISTORY_PARTITION_OFFSETS"),
+		ExportDir:               viper.GetString("EXPORT_DIR"),
+		GroupCacheTTL:           viper.GetInt("GROUP_CACHE_TTL"),
+		GroupWorkers:            viper.GetInt("GROUP_WORKERS"),
+		GroupPollInterval:       viper.GetInt("GROUP_POLL_INTERVAL"),
+		ClusterID:         DefaultClusterID,
 		CreateTestTopic:   viper.GetBool("CREATE_TEST_TOPIC"),
 		AWSRegion:         viper.GetString("AWS_REGION"),
 		AWSAccessKeyID:    viper.GetString("AWS_ACCESS_KEY_ID"),
@@ -67,5 +149,24 @@ func NewConfig() (*Config, error) {
 		KafkaUsername:     viper.GetString("KAFKA_USERNAME"),
 		KafkaPassword:     viper.GetString("KAFKA_PASSWORD"),
 		UseSASL:           viper.GetBool("USE_SASL"),
-	}, nil
+		SASLMechanism:     viper.GetString("KAFKA_SASL_MECHANISM"),
+		TLSEnabled:        viper.GetBool("KAFKA_TLS_ENABLED"),
+		TLSCAFile:         viper.GetString("KAFKA_TLS_CA_FILE"),
+		TLSCertFile:       viper.GetString("KAFKA_TLS_CERT_FILE"),
+		TLSKeyFile:        viper.GetString("KAFKA_TLS_KEY_FILE"),
+		TLSInsecureSkipVerify: viper.GetBool("KAFKA_TLS_INSECURE_SKIP_VERIFY"),
+		SchemaRegistryURL:      viper.GetString("SCHEMA_REGISTRY_URL"),
+		SchemaRegistryUsername: viper.GetString("SCHEMA_REGISTRY_USERNAME"),
+		SchemaRegistryPassword: viper.GetString("SCHEMA_REGISTRY_PASSWORD"),
+		SchemaDir:              viper.GetString("SCHEMA_DIR"),
+		ClustersFile:      viper.GetString("CLUSTERS_FILE"),
+	}
+
+	clusters, err := loadClusters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Clusters = clusters
+
+	return cfg, nil
 }
\ No newline at end of file
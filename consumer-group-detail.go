@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/IBM/sarama"
+)
+
+// ConsumerGroupDetail is the response of /consumer-groups/{group}. Assignor
+// is the partition assignment strategy the group agreed on, and Members is
+// keyed by member ID.
+type ConsumerGroupDetail struct {
+	Group        string                         `json:"group"`
+	State        string                         `json:"state"`
+	ProtocolType string                         `json:"protocolType"`
+	Assignor     string                         `json:"assignor"`
+	Coordinator  *GroupCoordinator              `json:"coordinator,omitempty"`
+	Members      map[string]ConsumerGroupMember `json:"members"`
+}
+
+type GroupCoordinator struct {
+	ID      int32  `json:"id"`
+	Address string `json:"address"`
+	Rack    string `json:"rack,omitempty"`
+}
+
+// ConsumerGroupMember is one member of a group. GroupInstanceID is set for
+// static members. Subscription and Assignment are only decoded for groups
+// using the consumer protocol; DecodeError says why they are missing.
+type ConsumerGroupMember struct {
+	MemberID        string             `json:"memberId"`
+	GroupInstanceID *string            `json:"groupInstanceId,omitempty"`
+	ClientID        string             `json:"clientId"`
+	Host            string             `json:"host"`
+	Rack            *string            `json:"rack,omitempty"`
+	Subscription    []string           `json:"subscription"`
+	Assignment      map[string][]int32 `json:"assignment"`
+	DecodeError     string             `json:"decodeError,omitempty"`
+}
+
+func newConsumerGroupMember(protocolType string, member *sarama.GroupMemberDescription) ConsumerGroupMember {
+	result := ConsumerGroupMember{
+		MemberID:        member.MemberId,
+		GroupInstanceID: member.GroupInstanceId,
+		ClientID:        member.ClientId,
+		Host:            member.ClientHost,
+		Subscription:    []string{},
+		Assignment:      map[string][]int32{},
+	}
+	if protocolType != "consumer" {
+		return result
+	}
+
+	metadata, err := member.GetMemberMetadata()
+	if err != nil {
+		result.DecodeError = fmt.Sprintf("member metadata: %v", err)
+	} else if metadata != nil {
+		result.Subscription = metadata.Topics
+		result.Rack = metadata.RackID
+	}
+
+	assignment, err := member.GetMemberAssignment()
+	if err != nil {
+		result.DecodeError = fmt.Sprintf("member assignment: %v", err)
+	} else if assignment != nil {
+		for topic, partitions := range assignment.Topics {
+			partitions = slices.Clone(partitions)
+			slices.Sort(partitions)
+			result.Assignment[topic] = partitions
+		}
+	}
+	return result
+}
+
+func (s *Server) serveConsumerGroup(w http.ResponseWriter, r *http.Request, group string) {
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	descriptions, err := s.describeGroups(admin, []string{group})
+	if err == nil && len(descriptions) == 0 {
+		err = fmt.Errorf("no description returned")
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+	description := descriptions[0]
+	if description.State == "Dead" {
+		http.Error(w, fmt.Sprintf("Group %s not found", group), http.StatusNotFound)
+		return
+	}
+
+	detail := ConsumerGroupDetail{
+		Group:        description.GroupId,
+		State:        description.State,
+		ProtocolType: description.ProtocolType,
+		Assignor:     description.Protocol,
+		Members:      make(map[string]ConsumerGroupMember, len(description.Members)),
+	}
+	if coordinator, err := s.kafkaConn.Coordinator(group); err == nil {
+		detail.Coordinator = &GroupCoordinator{ID: coordinator.ID(), Address: coordinator.Addr(), Rack: coordinator.Rack()}
+	}
+	for memberID, member := range description.Members {
+		detail.Members[memberID] = newConsumerGroupMember(description.ProtocolType, member)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
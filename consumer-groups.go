@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of /consumer-groups.
+const (
+	defaultGroupPageSize = 100
+	maxGroupPageSize     = 1000
+)
+
+type ConsumerGroupSummary struct {
+	Group        string                         `json:"group"`
+	State        string                         `json:"state"`
+	ProtocolType string                         `json:"protocolType"`
+	Assignor     string                         `json:"assignor"`
+	Members      map[string]ConsumerGroupMember `json:"members"`
+	Rebalances   *RebalanceStats                `json:"rebalances,omitempty"`
+}
+
+// ConsumerGroupPage is one page of /consumer-groups, sorted by group name.
+// Total is the number of groups matching the filters.
+type ConsumerGroupPage struct {
+	Total  int                    `json:"total"`
+	Offset int                    `json:"offset"`
+	Limit  int                    `json:"limit"`
+	Groups []ConsumerGroupSummary `json:"groups"`
+}
+
+// serveConsumerGroups lists consumer groups from the group cache. name keeps
+// groups whose name contains it, state keeps groups in any of the given
+// comma-separated states, and offset and limit select the page.
+func (s *Server) serveConsumerGroups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, limit := 0, defaultGroupPageSize
+	if raw := query.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("Invalid offset %q", raw), http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit %q", raw), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxGroupPageSize)
+	}
+	name := query.Get("name")
+	var states []string
+	if raw := query.Get("state"); raw != "" {
+		states = strings.Split(raw, ",")
+	}
+
+	if s.groupCache == nil {
+		http.Error(w, "Failed to list consumer groups: no Kafka client configured", http.StatusInternalServerError)
+		return
+	}
+	descriptions, err := s.groupCache.describe()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list consumer groups: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var groups []string
+	for group, description := range descriptions {
+		if name != "" && !strings.Contains(group, name) {
+			continue
+		}
+		if len(states) > 0 && !containsFold(states, description.State) {
+			continue
+		}
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	page := ConsumerGroupPage{Total: len(groups), Offset: offset, Limit: limit, Groups: []ConsumerGroupSummary{}}
+	now := time.Now()
+	start := min(offset, len(groups))
+	for _, group := range groups[start:min(start+limit, len(groups))] {
+		description := descriptions[group]
+		summary := ConsumerGroupSummary{
+			Group:        group,
+			State:        description.State,
+			ProtocolType: description.ProtocolType,
+			Assignor:     description.Protocol,
+			Members:      make(map[string]ConsumerGroupMember, len(description.Members)),
+		}
+		for memberID, member := range description.Members {
+			summary.Members[memberID] = newConsumerGroupMember(description.ProtocolType, member)
+		}
+		if stats, ok := s.rebalances.stats(group, now); ok {
+			summary.Rebalances = &stats
+		}
+		page.Groups = append(page.Groups, summary)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// PartitionLag is a group's position on one topic-partition.
+type PartitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	CommittedOffset int64  `json:"committedOffset"`
+	LogEndOffset    int64  `json:"logEndOffset"`
+	Lag             int64  `json:"lag"`
+	// LagSeconds is how long before the newest record the next record to
+	// consume was produced; LagEstimate says how it was derived.
+	LagSeconds  float64 `json:"lagSeconds"`
+	LagEstimate string  `json:"lagEstimate"`
+	MemberID    string  `json:"memberId,omitempty"`
+	ClientID    string  `json:"clientId,omitempty"`
+	Host        string  `json:"host,omitempty"`
+}
+
+// GroupLag is the response of /consumer-groups/{group}/lag.
+type GroupLag struct {
+	Group           string         `json:"group"`
+	State           string         `json:"state"`
+	TotalLag        int64          `json:"totalLag"`
+	MaxPartitionLag int64          `json:"maxPartitionLag"`
+	MaxLagSeconds   float64        `json:"maxLagSeconds"`
+	Partitions      []PartitionLag `json:"partitions"`
+}
+
+type partitionOwner struct {
+	memberID string
+	clientID string
+	host     string
+}
+
+func (s *Server) newClusterAdmin() (sarama.ClusterAdmin, error) {
+	if s.kafkaConn == nil {
+		return nil, fmt.Errorf("no Kafka client configured")
+	}
+	return sarama.NewClusterAdmin(strings.Split(s.config.KafkaBrokers, ","), s.kafkaConn.Config())
+}
+
+func (s *Server) serveConsumerGroupLag(w http.ResponseWriter, r *http.Request, group string) {
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	groupLag, err := s.getGroupLag(admin, group)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get lag for group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+	if groupLag.State == "Dead" && len(groupLag.Partitions) == 0 {
+		http.Error(w, fmt.Sprintf("Consumer group %s not found", group), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groupLag)
+}
+
+// getGroupLag reports the lag of every topic-partition the group has
+// committed offsets on, together with the member currently assigned to it.
+func (s *Server) getGroupLag(admin sarama.ClusterAdmin, group string) (*GroupLag, error) {
+	descriptions, err := admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, err
+	}
+	if len(descriptions) == 0 {
+		return nil, fmt.Errorf("no description returned for group %s", group)
+	}
+	description := descriptions[0]
+
+	owners := make(map[string]map[int32]partitionOwner)
+	for _, member := range description.Members {
+		assignment, err := member.GetMemberAssignment()
+		if err != nil || assignment == nil {
+			continue
+		}
+		for topic, partitions := range assignment.Topics {
+			if owners[topic] == nil {
+				owners[topic] = make(map[int32]partitionOwner)
+			}
+			for _, partition := range partitions {
+				owners[topic][partition] = partitionOwner{
+					memberID: member.MemberId,
+					clientID: member.ClientId,
+					host:     member.ClientHost,
+				}
+			}
+		}
+	}
+
+	offsetFetch, err := admin.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offsetFetch.Err != sarama.ErrNoError {
+		return nil, offsetFetch.Err
+	}
+
+	groupLag := &GroupLag{
+		Group:      group,
+		State:      description.State,
+		Partitions: []PartitionLag{},
+	}
+
+	for topic, blocks := range offsetFetch.Blocks {
+		for partition, block := range blocks {
+			if block.Offset == -1 {
+				continue
+			}
+
+			logEndOffset, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+
+			owner := owners[topic][partition]
+			groupLag.Partitions = append(groupLag.Partitions, PartitionLag{
+				Topic:           topic,
+				Partition:       partition,
+				CommittedOffset: block.Offset,
+				LogEndOffset:    logEndOffset,
+				Lag:             offsetLag(logEndOffset, block.Offset),
+				MemberID:        owner.memberID,
+				ClientID:        owner.clientID,
+				Host:            owner.host,
+			})
+		}
+	}
+
+	queries := make([]timeLagQuery, len(groupLag.Partitions))
+	for i, partitionLag := range groupLag.Partitions {
+		queries[i] = timeLagQuery{partitionLag.Topic, partitionLag.Partition, partitionLag.CommittedOffset, partitionLag.LogEndOffset}
+	}
+	for i, estimate := range s.estimateTimeLags(queries, true) {
+		partitionLag := &groupLag.Partitions[i]
+		partitionLag.LagSeconds = estimate.seconds
+		partitionLag.LagEstimate = estimate.estimate
+
+		groupLag.TotalLag += partitionLag.Lag
+		if partitionLag.Lag > groupLag.MaxPartitionLag {
+			groupLag.MaxPartitionLag = partitionLag.Lag
+		}
+		if partitionLag.LagSeconds > groupLag.MaxLagSeconds {
+			groupLag.MaxLagSeconds = partitionLag.LagSeconds
+		}
+	}
+
+	sort.Slice(groupLag.Partitions, func(i, j int) bool {
+		a, b := groupLag.Partitions[i], groupLag.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+
+	return groupLag, nil
+}
+
+// offsetLag never reports negative lag, which can briefly happen when the
+// log-end offset is read before a commit that has just landed.
+func offsetLag(logEndOffset, committed int64) int64 {
+	if committed > logEndOffset {
+		return 0
+	}
+	return logEndOffset - committed
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Offset reset strategies.
+const (
+	ResetEarliest  = "earliest"
+	ResetLatest    = "latest"
+	ResetOffset    = "offset"
+	ResetTimestamp = "timestamp"
+	ResetShift     = "shift"
+)
+
+// offsetResetPlanTTL is how long a previewed reset can be executed.
+const offsetResetPlanTTL = 15 * time.Minute
+
+// OffsetResetRequest is the body of POST
+// /consumer-groups/{group}/offsets/reset. Without Topics every partition the
+// group has committed offsets for is reset. Offset is used by the "offset"
+// strategy, Timestamp by "timestamp" and Shift (negative to rewind) by
+// "shift". Without Execute the reset is only previewed; executing commits
+// the previewed plan identified by PlanToken, and needs nothing else.
+type OffsetResetRequest struct {
+	Topics    []OffsetResetTopic `json:"topics"`
+	Strategy  string             `json:"strategy"`
+	Offset    *int64             `json:"offset"`
+	Timestamp *time.Time         `json:"timestamp"`
+	Shift     *int64             `json:"shift"`
+	Execute   bool               `json:"execute"`
+	PlanToken string             `json:"planToken"`
+}
+
+// OffsetResetTopic selects a topic, or some of its partitions.
+type OffsetResetTopic struct {
+	Topic      string  `json:"topic"`
+	Partitions []int32 `json:"partitions"`
+}
+
+// PartitionOffsetReset is the old and new committed offset of a partition.
+// CurrentOffset is null when the group has no committed offset there. Error
+// is set when the partition could not be reset; it is then left unchanged.
+type PartitionOffsetReset struct {
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	CurrentOffset *int64 `json:"currentOffset"`
+	NewOffset     int64  `json:"newOffset"`
+	LogStart      int64  `json:"logStartOffset"`
+	LogEnd        int64  `json:"logEndOffset"`
+	Error         string `json:"error,omitempty"`
+}
+
+// OffsetResetResult is a previewed or executed reset. A preview carries
+// the PlanToken to execute it with.
+type OffsetResetResult struct {
+	Group      string                 `json:"group"`
+	State      string                 `json:"state"`
+	Strategy   string                 `json:"strategy"`
+	DryRun     bool                   `json:"dryRun"`
+	PlanToken  string                 `json:"planToken,omitempty"`
+	Partitions []PartitionOffsetReset `json:"partitions"`
+}
+
+type offsetResetPlan struct {
+	result  OffsetResetResult
+	created time.Time
+}
+
+// offsetResetPlans holds previewed resets until they are executed or
+// expire.
+type offsetResetPlans struct {
+	mu    sync.Mutex
+	plans map[string]offsetResetPlan
+}
+
+func (p *offsetResetPlans) add(result OffsetResetResult) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.plans == nil {
+		p.plans = make(map[string]offsetResetPlan)
+	}
+	for t, plan := range p.plans {
+		if time.Since(plan.created) > offsetResetPlanTTL {
+			delete(p.plans, t)
+		}
+	}
+	p.plans[token] = offsetResetPlan{result: result, created: time.Now()}
+	return token, nil
+}
+
+func (p *offsetResetPlans) get(token, group string) (OffsetResetResult, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan, ok := p.plans[token]
+	if !ok || plan.result.Group != group || time.Since(plan.created) > offsetResetPlanTTL {
+		return OffsetResetResult{}, false
+	}
+	return plan.result, true
+}
+
+func (p *offsetResetPlans) remove(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.plans, token)
+}
+
+func (r *OffsetResetRequest) validate() error {
+	if r.Execute {
+		if r.PlanToken == "" {
+			return fmt.Errorf("executing needs the planToken of a preview; preview the reset first")
+		}
+		return nil
+	}
+	switch r.Strategy {
+	case ResetEarliest, ResetLatest:
+	case ResetOffset:
+		if r.Offset == nil {
+			return fmt.Errorf("strategy %q needs an offset", r.Strategy)
+		}
+	case ResetTimestamp:
+		if r.Timestamp == nil {
+			return fmt.Errorf("strategy %q needs a timestamp", r.Strategy)
+		}
+	case ResetShift:
+		if r.Shift == nil {
+			return fmt.Errorf("strategy %q needs a shift", r.Strategy)
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q; use earliest, latest, offset, timestamp or shift", r.Strategy)
+	}
+	for _, topic := range r.Topics {
+		if topic.Topic == "" {
+			return fmt.Errorf("every entry in topics needs a topic")
+		}
+	}
+	return nil
+}
+
+// resetGroupOffsets previews an offset reset, or commits one that was
+// previewed. Committing is refused unless the group is Empty, since active
+// members would overwrite the new offsets with their own commits, and when
+// the group's offsets or the logs changed since the preview.
+func (s *Server) resetGroupOffsets(w http.ResponseWriter, r *http.Request, group string) {
+	var req OffsetResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	descriptions, err := admin.DescribeConsumerGroups([]string{group})
+	if err != nil || len(descriptions) == 0 {
+		http.Error(w, fmt.Sprintf("Failed to describe group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+	state := descriptions[0].State
+	if req.Execute && state != "Empty" {
+		http.Error(w, fmt.Sprintf("Group %s is %s; offsets can only be reset while it is Empty, so stop its consumers first", group, state), http.StatusConflict)
+		return
+	}
+
+	offsetFetch, err := admin.ListConsumerGroupOffsets(group, nil)
+	if err == nil && offsetFetch.Err != sarama.ErrNoError {
+		err = offsetFetch.Err
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch offsets of group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Execute {
+		s.executeOffsetReset(w, &req, group, state, offsetFetch)
+		return
+	}
+
+	result, status, err := s.planGroupOffsetReset(&req, group, state, offsetFetch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to plan offset reset of group %s: %v", group, err), status)
+		return
+	}
+	if result.PlanToken, err = s.resetPlans.add(result); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store plan: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// planGroupOffsetReset works out the new offset of every selected
+// partition. It returns the HTTP status to respond with when it fails.
+func (s *Server) planGroupOffsetReset(req *OffsetResetRequest, group, state string, offsetFetch *sarama.OffsetFetchResponse) (OffsetResetResult, int, error) {
+	selected := make(map[string]map[int32]bool)
+	selectPartition := func(topic string, partition int32) {
+		if selected[topic] == nil {
+			selected[topic] = make(map[int32]bool)
+		}
+		selected[topic][partition] = true
+	}
+	if len(req.Topics) == 0 {
+		for topic, blocks := range offsetFetch.Blocks {
+			for partition, block := range blocks {
+				if block.Offset != -1 {
+					selectPartition(topic, partition)
+				}
+			}
+		}
+	}
+	for _, topic := range req.Topics {
+		partitions, err := s.kafkaConn.Partitions(topic.Topic)
+		if err != nil {
+			return OffsetResetResult{}, http.StatusBadRequest, fmt.Errorf("get partitions of topic %s: %v", topic.Topic, err)
+		}
+		if len(topic.Partitions) == 0 {
+			for _, partition := range partitions {
+				selectPartition(topic.Topic, partition)
+			}
+			continue
+		}
+		for _, partition := range topic.Partitions {
+			if partition < 0 || int(partition) >= len(partitions) {
+				return OffsetResetResult{}, http.StatusBadRequest, fmt.Errorf("topic %s has no partition %d", topic.Topic, partition)
+			}
+			selectPartition(topic.Topic, partition)
+		}
+	}
+
+	result := OffsetResetResult{
+		Group:      group,
+		State:      state,
+		Strategy:   req.Strategy,
+		DryRun:     true,
+		Partitions: []PartitionOffsetReset{},
+	}
+	for topic, partitions := range selected {
+		for partition := range partitions {
+			reset := PartitionOffsetReset{Topic: topic, Partition: partition, CurrentOffset: committedOffset(offsetFetch, topic, partition)}
+			if err := s.planOffsetReset(req, &reset); err != nil {
+				return OffsetResetResult{}, http.StatusInternalServerError, fmt.Errorf("compute offset for %s/%d: %v", topic, partition, err)
+			}
+			result.Partitions = append(result.Partitions, reset)
+		}
+	}
+	sort.Slice(result.Partitions, func(i, j int) bool {
+		a, b := result.Partitions[i], result.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return result, http.StatusOK, nil
+}
+
+// executeOffsetReset commits the plan previewed under req.PlanToken after
+// checking that the group's committed offsets are still those it was
+// planned from and that every new offset is still within its log.
+func (s *Server) executeOffsetReset(w http.ResponseWriter, req *OffsetResetRequest, group, state string, offsetFetch *sarama.OffsetFetchResponse) {
+	result, ok := s.resetPlans.get(req.PlanToken, group)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No previewed reset of group %s with plan token %q; it may have expired, so preview the reset again", group, req.PlanToken), http.StatusConflict)
+		return
+	}
+
+	for _, reset := range result.Partitions {
+		if reset.Error != "" {
+			continue
+		}
+		current := committedOffset(offsetFetch, reset.Topic, reset.Partition)
+		if (current == nil) != (reset.CurrentOffset == nil) || (current != nil && *current != *reset.CurrentOffset) {
+			http.Error(w, fmt.Sprintf("The committed offset of %s/%d changed since the preview; preview the reset again", reset.Topic, reset.Partition), http.StatusConflict)
+			return
+		}
+		logStart, err := s.kafkaConn.GetOffset(reset.Topic, reset.Partition, sarama.OffsetOldest)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get offsets of %s/%d: %v", reset.Topic, reset.Partition, err), http.StatusInternalServerError)
+			return
+		}
+		logEnd, err := s.kafkaConn.GetOffset(reset.Topic, reset.Partition, sarama.OffsetNewest)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get offsets of %s/%d: %v", reset.Topic, reset.Partition, err), http.StatusInternalServerError)
+			return
+		}
+		if reset.NewOffset < logStart || reset.NewOffset > logEnd {
+			http.Error(w, fmt.Sprintf("New offset %d of %s/%d is no longer within the log (%d to %d); preview the reset again", reset.NewOffset, reset.Topic, reset.Partition, logStart, logEnd), http.StatusConflict)
+			return
+		}
+	}
+
+	if err := s.commitGroupOffsets(group, result.Partitions); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit offsets of group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+	s.resetPlans.remove(req.PlanToken)
+	s.groupCache.invalidate()
+
+	result.State = state
+	result.DryRun = false
+	result.PlanToken = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func committedOffset(offsetFetch *sarama.OffsetFetchResponse, topic string, partition int32) *int64 {
+	if block := offsetFetch.GetBlock(topic, partition); block != nil && block.Offset != -1 {
+		current := block.Offset
+		return &current
+	}
+	return nil
+}
+
+// planOffsetReset fills in the log bounds and the new offset of reset. New
+// offsets are kept within the log, like kafka-consumer-groups does.
+func (s *Server) planOffsetReset(req *OffsetResetRequest, reset *PartitionOffsetReset) error {
+	var err error
+	if reset.LogStart, err = s.kafkaConn.GetOffset(reset.Topic, reset.Partition, sarama.OffsetOldest); err != nil {
+		return err
+	}
+	if reset.LogEnd, err = s.kafkaConn.GetOffset(reset.Topic, reset.Partition, sarama.OffsetNewest); err != nil {
+		return err
+	}
+
+	switch req.Strategy {
+	case ResetEarliest:
+		reset.NewOffset = reset.LogStart
+	case ResetLatest:
+		reset.NewOffset = reset.LogEnd
+	case ResetOffset:
+		reset.NewOffset = clampOffset(*req.Offset, reset.LogStart, reset.LogEnd)
+	case ResetTimestamp:
+		if reset.NewOffset, err = s.offsetForTime(reset.Topic, reset.Partition, *req.Timestamp, reset.LogEnd); err != nil {
+			return err
+		}
+	case ResetShift:
+		if reset.CurrentOffset == nil {
+			reset.Error = "no committed offset to shift from"
+			return nil
+		}
+		reset.NewOffset = clampOffset(*reset.CurrentOffset+*req.Shift, reset.LogStart, reset.LogEnd)
+	}
+	return nil
+}
+
+// commitGroupOffsets commits the new offsets as a standalone commit outside
+// of any generation, which the coordinator only accepts for groups without
+// members. Per-partition failures are recorded on the resets.
+func (s *Server) commitGroupOffsets(group string, resets []PartitionOffsetReset) error {
+	coordinator, err := s.kafkaConn.Coordinator(group)
+	if err != nil {
+		return err
+	}
+
+	request := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	blocks := 0
+	for _, reset := range resets {
+		if reset.Error == "" {
+			request.AddBlock(reset.Topic, reset.Partition, reset.NewOffset, 0, "")
+			blocks++
+		}
+	}
+	if blocks == 0 {
+		return nil
+	}
+
+	response, err := coordinator.CommitOffset(request)
+	if err != nil {
+		return err
+	}
+	for i := range resets {
+		if kerr, ok := response.Errors[resets[i].Topic][resets[i].Partition]; ok && kerr != sarama.ErrNoError {
+			resets[i].Error = kerr.Error()
+		}
+	}
+	return nil
+}
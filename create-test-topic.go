@@ -33,7 +33,7 @@ func CreateTestTopicIfRequired(config *config.Config) error {
 	}
 
 	// Create admin client
-	adminClient, err := createAdminClient(config.KafkaBrokers)
+	adminClient, err := createAdminClient(config)
 	if err != nil {
 		return fmt.Errorf("failed to create admin client: %w", err)
 	}
@@ -46,7 +46,7 @@ func CreateTestTopicIfRequired(config *config.Config) error {
 	}
 
 	// Create producer
-	producer, err := createProducer(config.KafkaBrokers)
+	producer, err := createProducer(config)
 	if err != nil {
 		return fmt.Errorf("failed to create producer: %w", err)
 	}
@@ -57,8 +57,8 @@ func CreateTestTopicIfRequired(config *config.Config) error {
 }
 
 // SendSampleMessages sends sample messages to a topic
-func SendSampleMessages(brokers string, topic string, messageCount int) error {
-	producer, err := createProducer(brokers)
+func SendSampleMessages(config *config.Config, topic string, messageCount int) error {
+	producer, err := createProducer(config)
 	if err != nil {
 		return fmt.Errorf("failed to create producer: %w", err)
 	}
@@ -109,11 +109,13 @@ func sendSampleMessages(producer sarama.SyncProducer, topic string, messageCount
 	return nil
 }
 
-func createAdminClient(brokers string) (sarama.ClusterAdmin, error) {
-	config := sarama.NewConfig()
-	config.Version = sarama.V2_6_0_0
+func createAdminClient(config *config.Config) (sarama.ClusterAdmin, error) {
+	kafkaConfig, err := newKafkaConfig(config)
+	if err != nil {
+		return nil, err
+	}
 
-	return sarama.NewClusterAdmin(strings.Split(brokers, ","), config)
+	return sarama.NewClusterAdmin(strings.Split(config.KafkaBrokers, ","), kafkaConfig)
 }
 
 func createTopicIfNotExists(adminClient sarama.ClusterAdmin, topic string, partitions int, replication int) error {
@@ -142,11 +144,13 @@ func createTopicIfNotExists(adminClient sarama.ClusterAdmin, topic string, parti
 	return nil
 }
 
-func createProducer(brokers string) (sarama.SyncProducer, error) {
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = 5
-	config.Producer.Return.Successes = true
+// createProducer uses the same SASL and TLS settings as the dashboard's
+// own client.
+func createProducer(config *config.Config) (sarama.SyncProducer, error) {
+	kafkaConfig, err := newKafkaConfig(config)
+	if err != nil {
+		return nil, err
+	}
 
-	return sarama.NewSyncProducer(strings.Split(brokers, ","), config)
+	return sarama.NewSyncProducer(strings.Split(config.KafkaBrokers, ","), kafkaConfig)
 }
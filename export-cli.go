@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/umerfarok/kafka-live-dashboard/config"
+)
+
+// runExportCommand implements `kafka-live-dashboard export`, which runs the
+// same export as POST /topics/{name}/export but writes the file locally.
+func runExportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	clusterID := flags.String("cluster", "", "cluster ID from CLUSTERS_FILE (default: the first cluster)")
+	topic := flags.String("topic", "", "topic to export (required)")
+	format := flags.String("format", ExportJSONL, "output format: jsonl, csv or parquet")
+	out := flags.String("out", "", "output file (default: stdout)")
+	partitions := flags.String("partitions", "", "comma separated partitions (default: all)")
+	startOffset := flags.String("start-offset", "", "first offset to export in every partition")
+	endOffset := flags.String("end-offset", "", "offset to stop before in every partition")
+	from := flags.String("from", "", "export records at or after this time (RFC3339 or unix ms)")
+	to := flags.String("to", "", "export records before this time (RFC3339 or unix ms)")
+	filter := flags.String("filter", "", "message filter expression")
+	columns := flags.String("columns", "", "CSV columns as comma separated name=source or source entries")
+	flags.Parse(args)
+
+	if *topic == "" {
+		flags.Usage()
+		return fmt.Errorf("-topic is required")
+	}
+
+	req := &ExportRequest{Format: *format, Filter: *filter}
+	var err error
+	if *partitions != "" {
+		if req.Partitions, err = parsePartitionList(*partitions); err != nil {
+			return err
+		}
+	}
+	if req.StartOffset, err = parseOptionalOffset(*startOffset); err != nil {
+		return fmt.Errorf("invalid -start-offset: %w", err)
+	}
+	if req.EndOffset, err = parseOptionalOffset(*endOffset); err != nil {
+		return fmt.Errorf("invalid -end-offset: %w", err)
+	}
+	if req.From, err = parseOptionalTime(*from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if req.To, err = parseOptionalTime(*to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+	if *columns != "" {
+		for _, column := range strings.Split(*columns, ",") {
+			name, source, ok := strings.Cut(column, "=")
+			if !ok {
+				source = name
+			}
+			req.Columns = append(req.Columns, ExportColumn{Name: strings.TrimSpace(name), Source: strings.TrimSpace(source)})
+		}
+	}
+
+	plan, err := newExportPlan(req)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cluster := cfg.Clusters[0]
+	if *clusterID != "" {
+		found := false
+		for _, c := range cfg.Clusters {
+			if c.ID == *clusterID {
+				cluster, found = c, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown cluster %s", *clusterID)
+		}
+	}
+
+	server, err := NewServer(cfg.ForCluster(cluster))
+	if err != nil {
+		return fmt.Errorf("failed to connect to cluster %s: %w", cluster.ID, err)
+	}
+	defer server.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	progress := &JobProgress{}
+	done := make(chan struct{})
+	go reportExportProgress(progress, done)
+	records, short, err := server.exportTopic(ctx, *topic, plan, w, progress)
+	close(done)
+	if err != nil {
+		return err
+	}
+	for _, partition := range short {
+		log.Printf("Partition %d had %d of %d records in its range", partition.Partition, partition.Read, partition.Expected)
+	}
+
+	log.Printf("Exported %d records from %s", records, *topic)
+	return nil
+}
+
+func reportExportProgress(progress *JobProgress, done chan struct{}) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			log.Printf("Read %d of %d records", progress.processed.Load(), progress.total.Load())
+		}
+	}
+}
+
+func parseOptionalOffset(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &offset, nil
+}
+
+func parseOptionalTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := parseMessageTime(s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Export formats.
+const (
+	ExportJSONL   = "jsonl"
+	ExportCSV     = "csv"
+	ExportParquet = "parquet"
+)
+
+// MessageRange selects records of a topic for a background job. The range
+// is given either as offsets, applied to every partition, or as a time
+// window; an open end stops at the newest record when the job starts.
+type MessageRange struct {
+	Partitions  []int32    `json:"partitions"`
+	StartOffset *int64     `json:"startOffset"`
+	EndOffset   *int64     `json:"endOffset"`
+	From        *time.Time `json:"from"`
+	To          *time.Time `json:"to"`
+}
+
+func (r *MessageRange) validate() error {
+	if (r.StartOffset != nil || r.EndOffset != nil) && (r.From != nil || r.To != nil) {
+		return fmt.Errorf("give either startOffset/endOffset or from/to, not both")
+	}
+	return nil
+}
+
+// ExportRequest selects the records to export and how to write them.
+// Filter uses the message filter syntax.
+type ExportRequest struct {
+	MessageRange
+	Format  string         `json:"format"`
+	Filter  string         `json:"filter"`
+	Columns []ExportColumn `json:"columns"`
+}
+
+// ExportColumn maps a CSV column to a record field: topic, partition,
+// offset, timestamp, key, value, headers, or any filter operand such as
+// $.user.id or header["source"].
+type ExportColumn struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+var defaultExportColumns = []ExportColumn{
+	{Name: "topic", Source: "topic"},
+	{Name: "partition", Source: "partition"},
+	{Name: "offset", Source: "offset"},
+	{Name: "timestamp", Source: "timestamp"},
+	{Name: "key", Source: "key"},
+	{Name: "value", Source: "value"},
+}
+
+// exportPlan is a validated ExportRequest.
+type exportPlan struct {
+	*ExportRequest
+	filter  *MessageFilter
+	columns []exportColumn
+}
+
+type exportColumn struct {
+	name      string
+	source    string
+	extractor *FieldExtractor
+}
+
+// ExportResult is reported with a completed export job.
+type ExportResult struct {
+	Records         int64            `json:"records"`
+	Bytes           int64            `json:"bytes"`
+	File            string           `json:"file"`
+	ShortPartitions []ShortPartition `json:"shortPartitions,omitempty"`
+}
+
+type exportFile struct {
+	path        string
+	filename    string
+	contentType string
+}
+
+// exportFiles remembers where each export job wrote its file.
+type exportFiles struct {
+	mu    sync.Mutex
+	files map[string]exportFile
+}
+
+func (e *exportFiles) set(jobID string, file exportFile) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.files == nil {
+		e.files = make(map[string]exportFile)
+	}
+	e.files[jobID] = file
+}
+
+func (e *exportFiles) get(jobID string) (exportFile, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	file, ok := e.files[jobID]
+	return file, ok
+}
+
+func (e *exportFiles) remove(jobID string) {
+	e.mu.Lock()
+	file, ok := e.files[jobID]
+	delete(e.files, jobID)
+	e.mu.Unlock()
+	if ok {
+		os.Remove(file.path)
+	}
+}
+
+func newExportPlan(req *ExportRequest) (*exportPlan, error) {
+	plan := &exportPlan{ExportRequest: req}
+
+	switch req.Format {
+	case "":
+		req.Format = ExportJSONL
+	case ExportJSONL, ExportCSV, ExportParquet:
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected jsonl, csv or parquet", req.Format)
+	}
+
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	if req.Filter != "" {
+		filter, err := CompileFilter(req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		plan.filter = filter
+	}
+
+	columns := req.Columns
+	if len(columns) == 0 {
+		columns = defaultExportColumns
+	}
+	for _, column := range columns {
+		c := exportColumn{name: column.Name, source: column.Source}
+		if c.name == "" {
+			c.name = c.source
+		}
+		switch c.source {
+		case "topic", "timestamp", "headers", "key", "value", "partition", "offset":
+		default:
+			extractor, err := CompileFieldExtractor(c.source)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.name, err)
+			}
+			c.extractor = extractor
+		}
+		plan.columns = append(plan.columns, c)
+	}
+
+	return plan, nil
+}
+
+func (p *exportPlan) extension() string {
+	return "." + p.Format
+}
+
+func (p *exportPlan) contentType() string {
+	switch p.Format {
+	case ExportCSV:
+		return "text/csv"
+	case ExportParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+func (s *Server) startExport(w http.ResponseWriter, r *http.Request, topic string) {
+	var req ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := newExportPlan(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dir := filepath.Join(s.config.ExportDir, s.config.ClusterID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create export directory: %v", err), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.CreateTemp(dir, topic+"-*"+plan.extension())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create export file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s%s", topic, time.Now().UTC().Format("20060102T150405Z"), plan.extension())
+	// The file is registered first so a download never finds the job
+	// without it.
+	jobID := newJobID()
+	s.exports.set(jobID, exportFile{path: f.Name(), filename: filename, contentType: plan.contentType()})
+	job := s.jobs.StartWithID(jobID, "export", func(ctx context.Context, progress *JobProgress) (interface{}, error) {
+		defer f.Close()
+		records, short, err := s.exportTopic(ctx, topic, plan, f, progress)
+		if err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return ExportResult{Records: records, Bytes: info.Size(), File: filename, ShortPartitions: short}, nil
+	}, func() { s.exports.remove(jobID) })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) serveExportDownload(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, ok := s.jobs.Get(jobID)
+	file, hasFile := s.exports.get(jobID)
+	if !ok || !hasFile {
+		http.Error(w, fmt.Sprintf("Export %s not found", jobID), http.StatusNotFound)
+		return
+	}
+	if job.State != JobCompleted {
+		http.Error(w, fmt.Sprintf("Export %s is %s", jobID, job.State), http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(file.path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open export: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", file.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.filename))
+	http.ServeContent(w, r, file.filename, *job.FinishedAt, f)
+}
+
+// exportTopic writes the records selected by plan to out, partition by
+// partition, and returns how many were written and the partitions that had
+// fewer records than their range spans. Progress counts records read,
+// including those the filter drops.
+func (s *Server) exportTopic(ctx context.Context, topic string, plan *exportPlan, out io.Writer, progress *JobProgress) (int64, []ShortPartition, error) {
+	writer, err := s.newExportWriter(plan, out)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var written int64
+	short, err := s.scanRange(ctx, topic, &plan.MessageRange, progress, func(msg *sarama.ConsumerMessage) error {
+		if !s.matchMessage(plan.filter, msg) {
+			return nil
+		}
+		written++
+		return writer.write(msg)
+	})
+	if err != nil {
+		return written, short, err
+	}
+	return written, short, writer.close()
+}
+
+// scanRange calls fn for every record in r, one partition after another,
+// and counts them in progress. It returns the partitions that had fewer
+// records than their range spans.
+func (s *Server) scanRange(ctx context.Context, topic string, r *MessageRange, progress *JobProgress, fn func(*sarama.ConsumerMessage) error) ([]ShortPartition, error) {
+	if s.kafkaConn == nil {
+		return nil, fmt.Errorf("no Kafka client configured")
+	}
+
+	ranges, err := s.resolveRange(topic, r)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, pr := range ranges {
+		total += pr.end - pr.start
+	}
+	progress.SetTotal(total)
+
+	consumer, err := sarama.NewConsumerFromClient(s.kafkaConn)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	var short []ShortPartition
+	for _, pr := range ranges {
+		if pr.start >= pr.end {
+			continue
+		}
+		read, err := consumeRange(ctx, consumer, topic, pr, func(msg *sarama.ConsumerMessage) error {
+			progress.Add(1)
+			return fn(msg)
+		})
+		if err != nil {
+			return short, err
+		}
+		if read < pr.end-pr.start {
+			short = append(short, ShortPartition{Partition: pr.partition, Expected: pr.end - pr.start, Read: read})
+		}
+	}
+	return short, nil
+}
+
+// resolveRange turns r into offsets on every selected partition.
+func (s *Server) resolveRange(topic string, r *MessageRange) ([]partitionRange, error) {
+	partitions := r.Partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = s.kafkaConn.Partitions(topic); err != nil {
+			return nil, err
+		}
+	}
+
+	ranges := make([]partitionRange, 0, len(partitions))
+	for _, partition := range partitions {
+		oldest, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+
+		pr := partitionRange{partition: partition, oldest: oldest, newest: newest, start: oldest, end: newest}
+		if r.StartOffset != nil {
+			pr.start = clampOffset(*r.StartOffset, oldest, newest)
+		}
+		if r.EndOffset != nil {
+			pr.end = clampOffset(*r.EndOffset, oldest, newest)
+		}
+		if r.From != nil {
+			if pr.start, err = s.offsetForTime(topic, partition, *r.From, newest); err != nil {
+				return nil, err
+			}
+		}
+		if r.To != nil {
+			if pr.end, err = s.offsetForTime(topic, partition, *r.To, newest); err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, pr)
+	}
+	return ranges, nil
+}
+
+// offsetForTime returns the first offset at or after t, or newest when no
+// record is that recent.
+func (s *Server) offsetForTime(topic string, partition int32, t time.Time, newest int64) (int64, error) {
+	offset, err := s.kafkaConn.GetOffset(topic, partition, t.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return newest, nil
+	}
+	return offset, nil
+}
+
+// Jobs check a partition that stopped delivering records after
+// rangeIdleTimeout, and fail once it has delivered nothing for
+// rangeStallTimeout although records are left in the range. They are
+// variables so tests can shorten them.
+var (
+	rangeIdleTimeout  = 2 * time.Second
+	rangeStallTimeout = 2 * time.Minute
+)
+
+// ShortPartition is a partition from which fewer records were read than its
+// offset range spans. Compaction and transaction markers leave offsets
+// without records, so this is expected on compacted and transactional
+// topics.
+type ShortPartition struct {
+	Partition int32 `json:"partition"`
+	Expected  int64 `json:"expected"`
+	Read      int64 `json:"read"`
+}
+
+// consumeRange calls fn for every record in [pr.start, pr.end) until ctx is
+// cancelled or fn fails, and returns how many records it read. The range
+// ends early only when the broker has no records left below pr.end; a
+// partition that stalls before that is an error.
+func consumeRange(ctx context.Context, consumer sarama.Consumer, topic string, pr partitionRange, fn func(*sarama.ConsumerMessage) error) (int64, error) {
+	partitionConsumer, err := consumer.ConsumePartition(topic, pr.partition, pr.start)
+	if err != nil {
+		return 0, err
+	}
+	defer partitionConsumer.Close()
+
+	var read int64
+	next := pr.start
+	lastRecord := time.Now()
+	idle := time.NewTimer(rangeIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return read, ctx.Err()
+		case msg := <-partitionConsumer.Messages():
+			if msg.Offset >= pr.end {
+				return read, nil
+			}
+			read++
+			if err := fn(msg); err != nil {
+				return read, err
+			}
+			if msg.Offset >= pr.end-1 {
+				return read, nil
+			}
+			next = msg.Offset + 1
+			lastRecord = time.Now()
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(rangeIdleTimeout)
+		case err := <-partitionConsumer.Errors():
+			return read, err
+		case <-idle.C:
+			// The high water mark is only known after a fetch; at or below
+			// pr.end it means the offsets left in the range hold no records.
+			if hwm := partitionConsumer.HighWaterMarkOffset(); hwm > 0 && hwm <= pr.end {
+				return read, nil
+			}
+			if time.Since(lastRecord) >= rangeStallTimeout {
+				return read, fmt.Errorf("partition %d stopped delivering records at offset %d, before the end of the range at %d", pr.partition, next, pr.end)
+			}
+			idle.Reset(rangeIdleTimeout)
+		}
+	}
+}
+
+type exportWriter interface {
+	write(msg *sarama.ConsumerMessage) error
+	close() error
+}
+
+func (s *Server) newExportWriter(plan *exportPlan, out io.Writer) (exportWriter, error) {
+	switch plan.Format {
+	case ExportCSV:
+		w := &csvExportWriter{server: s, columns: plan.columns, csv: csv.NewWriter(out)}
+		header := make([]string, len(plan.columns))
+		for i, column := range plan.columns {
+			header[i] = column.name
+		}
+		return w, w.csv.Write(header)
+	case ExportParquet:
+		return &parquetExportWriter{server: s, writer: parquet.NewGenericWriter[parquetExportRow](out)}, nil
+	}
+	return &jsonlExportWriter{server: s, encoder: json.NewEncoder(out)}, nil
+}
+
+// jsonlExportWriter writes one record envelope per line.
+type jsonlExportWriter struct {
+	server  *Server
+	encoder *json.Encoder
+}
+
+func (w *jsonlExportWriter) write(msg *sarama.ConsumerMessage) error {
+	return w.encoder.Encode(w.server.newMessageRecord(msg))
+}
+
+func (w *jsonlExportWriter) close() error { return nil }
+
+type csvExportWriter struct {
+	server  *Server
+	columns []exportColumn
+	csv     *csv.Writer
+}
+
+func (w *csvExportWriter) write(msg *sarama.ConsumerMessage) error {
+	record := w.server.newMessageRecord(msg)
+	value := msg.Value
+	if record.Value != nil && record.Value.Format != "" {
+		value = []byte(record.Value.Data)
+	}
+	c := &filterContext{msg: msg, rawValue: value}
+
+	row := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		switch column.source {
+		case "topic":
+			row[i] = msg.Topic
+		case "partition":
+			row[i] = strconv.Itoa(int(msg.Partition))
+		case "offset":
+			row[i] = strconv.FormatInt(msg.Offset, 10)
+		case "timestamp":
+			row[i] = msg.Timestamp.UTC().Format(time.RFC3339Nano)
+		case "key":
+			row[i] = payloadText(record.Key)
+		case "value":
+			row[i] = payloadText(record.Value)
+		case "headers":
+			headers, _ := json.Marshal(record.Headers)
+			row[i] = string(headers)
+		default:
+			if v, ok := column.extractor.extract(c); ok {
+				row[i] = formatFieldValue(v)
+			}
+		}
+	}
+	return w.csv.Write(row)
+}
+
+func (w *csvExportWriter) close() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func payloadText(p *Payload) string {
+	if p == nil {
+		return ""
+	}
+	return p.Data
+}
+
+// formatFieldValue renders an extracted field as text: strings as they
+// are, other values as JSON and a missing value as an empty string.
+func formatFieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// parquetExportRow is the fixed Parquet schema of an export. Key and value
+// hold the envelope payload text, so binary payloads stay base64 encoded,
+// and headers are a JSON array.
+type parquetExportRow struct {
+	Topic     string    `parquet:"topic"`
+	Partition int32     `parquet:"partition"`
+	Offset    int64     `parquet:"offset"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Key       *string   `parquet:"key,optional"`
+	Value     *string   `parquet:"value,optional"`
+	Headers   string    `parquet:"headers"`
+}
+
+type parquetExportWriter struct {
+	server *Server
+	writer *parquet.GenericWriter[parquetExportRow]
+}
+
+func (w *parquetExportWriter) write(msg *sarama.ConsumerMessage) error {
+	record := w.server.newMessageRecord(msg)
+	headers, _ := json.Marshal(record.Headers)
+	row := parquetExportRow{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Headers:   string(headers),
+	}
+	if record.Key != nil {
+		row.Key = &record.Key.Data
+	}
+	if record.Value != nil {
+		row.Value = &record.Value.Data
+	}
+	_, err := w.writer.Write([]parquetExportRow{row})
+	return err
+}
+
+func (w *parquetExportWriter) close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+func shortenRangeTimeouts(t *testing.T) {
+	idle, stall := rangeIdleTimeout, rangeStallTimeout
+	rangeIdleTimeout, rangeStallTimeout = 10*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { rangeIdleTimeout, rangeStallTimeout = idle, stall })
+}
+
+func TestConsumeRange(t *testing.T) {
+	shortenRangeTimeouts(t)
+
+	for _, tc := range []struct {
+		name      string
+		start     int64
+		records   int
+		end       int64
+		wantRead  int64
+		wantError string
+	}{
+		{name: "whole range", records: 5, end: 3, wantRead: 3},
+		{name: "records missing at the end of the log", records: 2, end: 5, wantRead: 2},
+		{name: "empty range at the end of the log", start: 4, end: 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			consumer := mocks.NewConsumer(t, nil)
+			partition := consumer.ExpectConsumePartition("orders", 0, tc.start)
+			for i := 0; i < tc.records; i++ {
+				partition.YieldMessage(&sarama.ConsumerMessage{Value: []byte("v")})
+			}
+
+			var offsets []int64
+			pr := partitionRange{partition: 0, start: tc.start, end: tc.end}
+			read, err := consumeRange(context.Background(), consumer, "orders", pr, func(msg *sarama.ConsumerMessage) error {
+				offsets = append(offsets, msg.Offset)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read != tc.wantRead || int64(len(offsets)) != tc.wantRead {
+				t.Errorf("read %d records (%v), want %d", read, offsets, tc.wantRead)
+			}
+		})
+	}
+}
+
+func TestConsumeRangeStalled(t *testing.T) {
+	shortenRangeTimeouts(t)
+
+	// Without a fetch the high water mark is unknown, so the records left in
+	// the range may still exist.
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.ExpectConsumePartition("orders", 0, mocks.AnyOffset)
+
+	pr := partitionRange{partition: 0, start: 10, end: 20}
+	read, err := consumeRange(context.Background(), consumer, "orders", pr, func(*sarama.ConsumerMessage) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "stopped delivering records at offset 10") {
+		t.Errorf("got %d records and error %v, want a stall at offset 10", read, err)
+	}
+}
+
+func TestConsumeRangeCancelled(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.ExpectConsumePartition("orders", 0, mocks.AnyOffset)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pr := partitionRange{partition: 0, start: 10, end: 20}
+	if _, err := consumeRange(ctx, consumer, "orders", pr, func(*sarama.ConsumerMessage) error { return nil }); err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FakeMetadataSource is an in-memory ClusterMetadataSource for exercising
+// handlers without a running cluster.
+type FakeMetadataSource struct {
+	mu       sync.RWMutex
+	topics   map[string]TopicMetadata
+	offsets  map[string]map[int32]PartitionOffsets
+	brokers  []BrokerInfo
+	watchers []chan MetadataEvent
+}
+
+func NewFakeMetadataSource() *FakeMetadataSource {
+	return &FakeMetadataSource{
+		topics:  make(map[string]TopicMetadata),
+		offsets: make(map[string]map[int32]PartitionOffsets),
+	}
+}
+
+// SetTopic adds or replaces a topic and notifies watchers.
+func (f *FakeMetadataSource) SetTopic(topic TopicMetadata, offsets map[int32]PartitionOffsets) {
+	f.mu.Lock()
+	f.topics[topic.Name] = topic
+	f.offsets[topic.Name] = offsets
+	f.mu.Unlock()
+
+	f.notify(MetadataEvent{Type: MetadataEventTopics})
+}
+
+func (f *FakeMetadataSource) DeleteTopic(name string) {
+	f.mu.Lock()
+	delete(f.topics, name)
+	delete(f.offsets, name)
+	f.mu.Unlock()
+
+	f.notify(MetadataEvent{Type: MetadataEventTopics})
+}
+
+// SetBrokers replaces the broker list and notifies watchers.
+func (f *FakeMetadataSource) SetBrokers(brokers []BrokerInfo) {
+	f.mu.Lock()
+	f.brokers = append([]BrokerInfo(nil), brokers...)
+	f.mu.Unlock()
+
+	f.notify(MetadataEvent{Type: MetadataEventBrokers})
+}
+
+func (f *FakeMetadataSource) ListTopics() ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	topics := make([]string, 0, len(f.topics))
+	for name := range f.topics {
+		topics = append(topics, name)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+func (f *FakeMetadataSource) DescribeTopics(topics []string) ([]TopicMetadata, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	metadata := make([]TopicMetadata, 0, len(topics))
+	for _, name := range topics {
+		topic, ok := f.topics[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown topic %s", name)
+		}
+		metadata = append(metadata, topic)
+	}
+	return metadata, nil
+}
+
+func (f *FakeMetadataSource) ListBrokers() ([]BrokerInfo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return append([]BrokerInfo(nil), f.brokers...), nil
+}
+
+func (f *FakeMetadataSource) PartitionOffsets(topic string) (map[int32]PartitionOffsets, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	offsets, ok := f.offsets[topic]
+	if !ok {
+		return nil, fmt.Errorf("unknown topic %s", topic)
+	}
+
+	copied := make(map[int32]PartitionOffsets, len(offsets))
+	for partition, offset := range offsets {
+		copied[partition] = offset
+	}
+	return copied, nil
+}
+
+func (f *FakeMetadataSource) Watch(done <-chan struct{}) <-chan MetadataEvent {
+	watcher := make(chan MetadataEvent, 16)
+
+	f.mu.Lock()
+	f.watchers = append(f.watchers, watcher)
+	f.mu.Unlock()
+
+	events := make(chan MetadataEvent)
+	go func() {
+		defer close(events)
+		defer f.removeWatcher(watcher)
+		for {
+			select {
+			case event := <-watcher:
+				if !sendEvent(events, done, event) {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+func (f *FakeMetadataSource) Close() error {
+	return nil
+}
+
+func (f *FakeMetadataSource) notify(event MetadataEvent) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, watcher := range f.watchers {
+		select {
+		case watcher <- event:
+		default:
+		}
+	}
+}
+
+func (f *FakeMetadataSource) removeWatcher(watcher chan MetadataEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, w := range f.watchers {
+		if w == watcher {
+			f.watchers = append(f.watchers[:i], f.watchers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umerfarok/kafka-live-dashboard/config"
+)
+
+// newFakeServer returns a server without a Kafka client, backed by a fake
+// metadata source the test fills in.
+func newFakeServer(t *testing.T) (*Server, *FakeMetadataSource) {
+	t.Helper()
+	source := NewFakeMetadataSource()
+	s := NewServerWithSource(&config.Config{}, nil, source)
+	t.Cleanup(func() { s.Close() })
+	return s, source
+}
+
+// getJSON serves a GET request for path and decodes the JSON response into
+// v, failing the test unless the status is 200.
+func getJSON(t *testing.T, s *Server, path string, v interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", path, rec.Code, rec.Body.String())
+	}
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: decoding response: %v", path, err)
+	}
+}
+
+// postJSON serves a POST request for path with body as its JSON body.
+func postJSON(t *testing.T, s *Server, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+// setTopic adds a topic to source with every partition holding ten records.
+func setTopic(source *FakeMetadataSource, topic TopicMetadata) {
+	offsets := make(map[int32]PartitionOffsets, len(topic.Partitions))
+	for _, partition := range topic.Partitions {
+		offsets[partition.ID] = PartitionOffsets{Oldest: 0, Newest: 10}
+	}
+	source.SetTopic(topic, offsets)
+}
+
+func testBrokers(ids ...int32) []BrokerInfo {
+	brokers := make([]BrokerInfo, len(ids))
+	for i, id := range ids {
+		brokers[i] = BrokerInfo{ID: id, Hostname: "localhost", Port: 9092 + id}
+	}
+	return brokers
+}
+
+// inventoryTopic has two partitions replicated on brokers 1 and 2.
+var inventoryTopic = TopicMetadata{
+	Name: "inventory",
+	Partitions: []PartitionMetadata{
+		{ID: 0, Leader: 1, Replicas: []int32{1, 2}, ISR: []int32{1, 2}},
+		{ID: 1, Leader: 2, Replicas: []int32{2, 1}, ISR: []int32{2}},
+	},
+}
+
+func TestFakeMetadataSource(t *testing.T) {
+	source := NewFakeMetadataSource()
+	setTopic(source, inventoryTopic)
+	setTopic(source, TopicMetadata{Name: "audit", Partitions: []PartitionMetadata{{ID: 0, Leader: 1, Replicas: []int32{1}}}})
+	source.SetBrokers(testBrokers(1, 2))
+
+	topics, err := source.ListTopics()
+	if err != nil || !reflect.DeepEqual(topics, []string{"audit", "inventory"}) {
+		t.Fatalf("ListTopics = %v, %v; want [audit inventory]", topics, err)
+	}
+	metadata, err := source.DescribeTopics([]string{"inventory"})
+	if err != nil || len(metadata) != 1 || !reflect.DeepEqual(metadata[0], inventoryTopic) {
+		t.Errorf("DescribeTopics = %+v, %v", metadata, err)
+	}
+	if _, err := source.DescribeTopics([]string{"inventory", "missing"}); err == nil {
+		t.Error("DescribeTopics of a missing topic succeeded")
+	}
+	brokers, _ := source.ListBrokers()
+	if !reflect.DeepEqual(brokers, testBrokers(1, 2)) {
+		t.Errorf("ListBrokers = %+v", brokers)
+	}
+
+	offsets, err := source.PartitionOffsets("inventory")
+	if err != nil || offsets[1] != (PartitionOffsets{Oldest: 0, Newest: 10}) {
+		t.Fatalf("PartitionOffsets = %v, %v", offsets, err)
+	}
+	offsets[1] = PartitionOffsets{Newest: 99}
+	if again, _ := source.PartitionOffsets("inventory"); again[1].Newest != 10 {
+		t.Error("PartitionOffsets returned the source's own map")
+	}
+
+	source.DeleteTopic("audit")
+	if topics, _ := source.ListTopics(); !reflect.DeepEqual(topics, []string{"inventory"}) {
+		t.Errorf("ListTopics after DeleteTopic = %v", topics)
+	}
+	if _, err := source.PartitionOffsets("audit"); err == nil {
+		t.Error("PartitionOffsets of a deleted topic succeeded")
+	}
+}
+
+func TestFakeMetadataSourceWatch(t *testing.T) {
+	source := NewFakeMetadataSource()
+	done := make(chan struct{})
+	events := source.Watch(done)
+
+	receive := func() MetadataEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("no metadata event")
+			return MetadataEvent{}
+		}
+	}
+	setTopic(source, inventoryTopic)
+	if event := receive(); event.Type != MetadataEventTopics {
+		t.Errorf("event after SetTopic = %+v", event)
+	}
+	source.SetBrokers(testBrokers(1))
+	if event := receive(); event.Type != MetadataEventBrokers {
+		t.Errorf("event after SetBrokers = %+v", event)
+	}
+
+	close(done)
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("event after the watch was stopped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("events not closed after the watch was stopped")
+	}
+}
+
+func TestServeKafkaMetrics(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2))
+	source.SetTopic(inventoryTopic, map[int32]PartitionOffsets{0: {Oldest: 5, Newest: 20}, 1: {Oldest: 0, Newest: 3}})
+
+	var metrics struct {
+		Brokers []int32
+		Topics  map[string]map[string]struct {
+			OffsetNewest int64
+			OffsetOldest int64
+			Leader       int32
+			Replicas     []int32
+			ISR          []int32
+		}
+	}
+	getJSON(t, s, "/kafka_metrics", &metrics)
+	if !reflect.DeepEqual(metrics.Brokers, []int32{1, 2}) {
+		t.Errorf("brokers = %v, want [1 2]", metrics.Brokers)
+	}
+	partitions := metrics.Topics["inventory"]
+	if len(metrics.Topics) != 1 || len(partitions) != 2 {
+		t.Fatalf("topics = %+v", metrics.Topics)
+	}
+	if p := partitions["0"]; p.OffsetOldest != 5 || p.OffsetNewest != 20 || p.Leader != 1 {
+		t.Errorf("partition 0 = %+v", p)
+	}
+	if p := partitions["1"]; p.Leader != 2 || !reflect.DeepEqual(p.Replicas, []int32{2, 1}) || !reflect.DeepEqual(p.ISR, []int32{2}) {
+		t.Errorf("partition 1 = %+v", p)
+	}
+}
+
+func TestServeTopics(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2))
+	source.SetTopic(inventoryTopic, map[int32]PartitionOffsets{0: {Oldest: 5, Newest: 20}, 1: {Oldest: 0, Newest: 3}})
+
+	var topics []TopicStatus
+	getJSON(t, s, "/topics", &topics)
+	if len(topics) != 1 || topics[0].Name != "inventory" || topics[0].Partitions != 2 ||
+		topics[0].Replication != 2 || topics[0].Messages != 18 || topics[0].TotalLag != 0 {
+		t.Errorf("topics = %+v", topics)
+	}
+
+	var metrics TopicMetrics
+	getJSON(t, s, "/topics/inventory", &metrics)
+	if metrics.Partitions != 2 || metrics.Messages != 18 || len(metrics.Lag) != 0 {
+		t.Errorf("topic metrics = %+v", metrics)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/topics/missing", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET /topics/missing: status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestServeClusterStatus(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2))
+	setTopic(source, inventoryTopic)
+
+	var status ClusterStatus
+	getJSON(t, s, "/", &status)
+	if status.TotalTopics != 1 || status.Partitions != 2 || len(status.Brokers) != 2 || status.Stale || status.LastUpdated.IsZero() {
+		t.Errorf("status = %+v", status)
+	}
+
+	// The snapshot only changes when the refresher runs.
+	setTopic(source, TopicMetadata{Name: "audit", Partitions: []PartitionMetadata{{ID: 0, Leader: 1, Replicas: []int32{1}, ISR: []int32{1}}}})
+	getJSON(t, s, "/", &status)
+	if status.TotalTopics != 1 {
+		t.Errorf("TotalTopics = %d before a refresh, want 1", status.TotalTopics)
+	}
+	s.refreshNow()
+	getJSON(t, s, "/", &status)
+	if status.TotalTopics != 2 || status.Partitions != 3 || status.Topics[0].Name != "audit" {
+		t.Errorf("status after refresh = %+v", status)
+	}
+}
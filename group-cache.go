@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// describeBatchSize is the most groups described in one request.
+const describeBatchSize = 100
+
+// groupCache holds the descriptions and committed offsets of every consumer
+// group for a short TTL. Requests go to each group's coordinator, batched
+// per coordinator where the protocol allows it, and at most workers
+// requests run at once. Callers arriving during a fetch wait for it.
+type groupCache struct {
+	client   sarama.Client
+	newAdmin func() (sarama.ClusterAdmin, error)
+	ttl      time.Duration
+	workers  int
+	observe  func(*sarama.GroupDescription, time.Time)
+
+	describeMu   sync.Mutex
+	descriptions map[string]*sarama.GroupDescription
+	describedAt  time.Time
+
+	offsetsMu sync.Mutex
+	offsets   map[string]map[string]map[int32]int64
+	fetchedAt time.Time
+}
+
+func newGroupCache(client sarama.Client, newAdmin func() (sarama.ClusterAdmin, error), ttl time.Duration, workers int, observe func(*sarama.GroupDescription, time.Time)) *groupCache {
+	if ttl <= 0 {
+		ttl = 10 * time.Second
+	}
+	if workers <= 0 {
+		workers = 8
+	}
+	return &groupCache{client: client, newAdmin: newAdmin, ttl: ttl, workers: workers, observe: observe}
+}
+
+// describe returns the description of every consumer group, keyed by group.
+// Groups that failed to be described keep their previous description; it
+// fails if any group has none.
+func (c *groupCache) describe() (map[string]*sarama.GroupDescription, error) {
+	c.describeMu.Lock()
+	defer c.describeMu.Unlock()
+	if c.descriptions != nil && time.Since(c.describedAt) < c.ttl {
+		return c.descriptions, nil
+	}
+	descriptions, failed, err := c.fetchDescriptions()
+	if err != nil {
+		return nil, err
+	}
+	var missing int
+	for _, group := range failed {
+		if _, ok := descriptions[group]; !ok {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("%d of %d consumer groups could not be described", missing, len(descriptions)+missing)
+	}
+	return descriptions, nil
+}
+
+// refresh describes every consumer group regardless of the TTL. It also
+// returns the groups that failed to be described, which keep their
+// previous description if they had one.
+func (c *groupCache) refresh() (map[string]*sarama.GroupDescription, []string, error) {
+	c.describeMu.Lock()
+	defer c.describeMu.Unlock()
+	return c.fetchDescriptions()
+}
+
+func (c *groupCache) fetchDescriptions() (map[string]*sarama.GroupDescription, []string, error) {
+	groups, err := c.listGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := describeGroupsVersion(c.client.Config().Version)
+	var mu sync.Mutex
+	described := make(map[string]*sarama.GroupDescription, len(groups))
+	failed := c.perCoordinator(groups, describeBatchSize, func(coordinator *sarama.Broker, batch []string) ([]string, error) {
+		response, err := coordinator.DescribeGroups(&sarama.DescribeGroupsRequest{Version: version, Groups: batch})
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		var failed []string
+		for _, description := range response.Groups {
+			if description.Err != sarama.ErrNoError {
+				log.Printf("Failed to describe group %s: %v", description.GroupId, description.Err)
+				failed = append(failed, description.GroupId)
+				continue
+			}
+			described[description.GroupId] = description
+		}
+		return failed, nil
+	})
+
+	now := time.Now()
+	if c.observe != nil {
+		for _, description := range described {
+			c.observe(description, now)
+		}
+	}
+	descriptions := described
+	for _, group := range failed {
+		if previous, ok := c.descriptions[group]; ok {
+			descriptions[group] = previous
+		}
+	}
+	c.descriptions = descriptions
+	if len(failed) == 0 {
+		c.describedAt = now
+	}
+	return descriptions, failed, nil
+}
+
+// committedOffsets returns every group's committed offsets as group, topic,
+// partition to offset. OffsetFetch takes one group per request, so these
+// are only parallelised, one request per group. Groups whose offsets
+// couldn't be fetched keep their previous offsets.
+func (c *groupCache) committedOffsets() (map[string]map[string]map[int32]int64, error) {
+	c.offsetsMu.Lock()
+	defer c.offsetsMu.Unlock()
+	if c.offsets != nil && time.Since(c.fetchedAt) < c.ttl {
+		return c.offsets, nil
+	}
+
+	groups, err := c.listGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	version := c.client.Config().Version
+	var mu sync.Mutex
+	offsets := make(map[string]map[string]map[int32]int64, len(groups))
+	failed := c.perCoordinator(groups, 1, func(coordinator *sarama.Broker, batch []string) ([]string, error) {
+		group := batch[0]
+		response, err := coordinator.FetchOffset(sarama.NewOffsetFetchRequest(version, group, nil))
+		if err == nil && response.Err != sarama.ErrNoError {
+			err = response.Err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		committed := make(map[string]map[int32]int64)
+		for topic, blocks := range response.Blocks {
+			for partition, block := range blocks {
+				if block.Err != sarama.ErrNoError || block.Offset == -1 {
+					continue
+				}
+				if committed[topic] == nil {
+					committed[topic] = make(map[int32]int64)
+				}
+				committed[topic][partition] = block.Offset
+			}
+		}
+		mu.Lock()
+		offsets[group] = committed
+		mu.Unlock()
+		return nil, nil
+	})
+
+	for _, group := range failed {
+		if previous, ok := c.offsets[group]; ok {
+			offsets[group] = previous
+		}
+	}
+	c.offsets = offsets
+	c.fetchedAt = time.Now()
+	return offsets, nil
+}
+
+// invalidate drops cached results after the groups were changed.
+func (c *groupCache) invalidate() {
+	c.describeMu.Lock()
+	c.descriptions = nil
+	c.describeMu.Unlock()
+	c.offsetsMu.Lock()
+	c.offsets = nil
+	c.offsetsMu.Unlock()
+}
+
+func (c *groupCache) listGroups() ([]string, error) {
+	admin, err := c.newAdmin()
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	listed, err := admin.ListConsumerGroups()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(listed))
+	for group := range listed {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// perCoordinator looks up the coordinator of every group, splits each
+// coordinator's groups into batches of at most size and calls fn for each
+// batch on a pool of c.workers goroutines. fn returns the groups of the
+// batch it failed for. perCoordinator returns every group that failed,
+// including those whose coordinator wasn't found or whose batch failed
+// entirely, after logging why.
+func (c *groupCache) perCoordinator(groups []string, size int, fn func(coordinator *sarama.Broker, batch []string) ([]string, error)) []string {
+	type batch struct {
+		coordinator *sarama.Broker
+		groups      []string
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	byCoordinator := make(map[int32][]string)
+	coordinators := make(map[int32]*sarama.Broker)
+	c.run(len(groups), func(i int) {
+		coordinator, err := c.client.Coordinator(groups[i])
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to find coordinator of group %s: %v", groups[i], err)
+			failed = append(failed, groups[i])
+			return
+		}
+		coordinators[coordinator.ID()] = coordinator
+		byCoordinator[coordinator.ID()] = append(byCoordinator[coordinator.ID()], groups[i])
+	})
+
+	var batches []batch
+	for id, members := range byCoordinator {
+		for len(members) > 0 {
+			n := min(size, len(members))
+			batches = append(batches, batch{coordinators[id], members[:n]})
+			members = members[n:]
+		}
+	}
+
+	c.run(len(batches), func(i int) {
+		b := batches[i]
+		_ = b.coordinator.Open(c.client.Config())
+		batchFailed, err := fn(b.coordinator, b.groups)
+		if err != nil {
+			log.Printf("Failed request to coordinator %d for %d groups: %v", b.coordinator.ID(), len(b.groups), err)
+			for _, group := range b.groups {
+				_ = c.client.RefreshCoordinator(group)
+			}
+			batchFailed = b.groups
+		}
+		mu.Lock()
+		failed = append(failed, batchFailed...)
+		mu.Unlock()
+	})
+	return failed
+}
+
+// run calls fn for 0..n-1 on at most c.workers goroutines.
+func (c *groupCache) run(n int, fn func(i int)) {
+	runWorkers(n, c.workers, fn)
+}
+
+// runWorkers calls fn for 0..n-1 on at most workers goroutines.
+func runWorkers(n, workers int, fn func(i int)) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+func describeGroupsVersion(version sarama.KafkaVersion) int16 {
+	switch {
+	case version.IsAtLeast(sarama.V2_4_0_0):
+		return 4
+	case version.IsAtLeast(sarama.V2_3_0_0):
+		return 3
+	case version.IsAtLeast(sarama.V2_0_0_0):
+		return 2
+	case version.IsAtLeast(sarama.V1_1_0_0):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// GroupDeletionResult is the outcome for one group. Status is "deleted",
+// "would-delete" on a dry run, "skipped" (with the Reason) or "failed".
+// EmptySince is when the dashboard first saw the group Empty.
+type GroupDeletionResult struct {
+	Group      string     `json:"group"`
+	State      string     `json:"state"`
+	EmptySince *time.Time `json:"emptySince,omitempty"`
+	Topic      string     `json:"topic,omitempty"`
+	Partitions []int32    `json:"partitions,omitempty"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+type GroupDeletionResponse struct {
+	DryRun  bool                  `json:"dryRun,omitempty"`
+	Results []GroupDeletionResult `json:"results"`
+}
+
+// GroupBulkDeletion is the body of POST /consumer-groups/delete. Pattern is
+// a regular expression that must match the whole group name, and EmptyFor
+// (such as "24h") is how long a group must have been Empty.
+type GroupBulkDeletion struct {
+	Pattern  string `json:"pattern"`
+	EmptyFor string `json:"emptyFor"`
+	DryRun   bool   `json:"dryRun"`
+}
+
+func (s *Server) deleteConsumerGroup(w http.ResponseWriter, r *http.Request, group string) {
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	result, status, err := s.describeForDeletion(admin, group)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete group %s: %v", group, err), status)
+		return
+	}
+
+	if err := admin.DeleteConsumerGroup(group); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+	result.Status = "deleted"
+	s.groupCache.invalidate()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GroupDeletionResponse{Results: []GroupDeletionResult{result}})
+}
+
+// deleteGroupOffsets deletes a group's committed offsets for the topic
+// given by the topic query parameter.
+func (s *Server) deleteGroupOffsets(w http.ResponseWriter, r *http.Request, group string) {
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		http.Error(w, "Topic not specified", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	result, status, err := s.describeForDeletion(admin, group)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete offsets of group %s: %v", group, err), status)
+		return
+	}
+
+	partitions, err := s.kafkaConn.Partitions(topic)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get partitions of topic %s: %v", topic, err), http.StatusBadRequest)
+		return
+	}
+	offsetFetch, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err == nil && offsetFetch.Err != sarama.ErrNoError {
+		err = offsetFetch.Err
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch offsets of group %s: %v", group, err), http.StatusInternalServerError)
+		return
+	}
+
+	result.Topic = topic
+	result.Status = "deleted"
+	for _, partition := range partitions {
+		if block := offsetFetch.GetBlock(topic, partition); block == nil || block.Offset == -1 {
+			continue
+		}
+		if err := admin.DeleteConsumerGroupOffset(group, topic, partition); err != nil {
+			result.Status = "failed"
+			result.Reason = fmt.Sprintf("partition %d: %v", partition, err)
+			break
+		}
+		result.Partitions = append(result.Partitions, partition)
+	}
+	s.groupCache.invalidate()
+	if result.Status == "deleted" && len(result.Partitions) == 0 {
+		http.Error(w, fmt.Sprintf("Group %s has no committed offsets for topic %s", group, topic), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GroupDeletionResponse{Results: []GroupDeletionResult{result}})
+}
+
+// describeForDeletion checks that group exists and is Empty. It returns the
+// HTTP status to respond with when it isn't.
+func (s *Server) describeForDeletion(admin sarama.ClusterAdmin, group string) (GroupDeletionResult, int, error) {
+	descriptions, err := s.describeGroups(admin, []string{group})
+	if err != nil || len(descriptions) == 0 {
+		return GroupDeletionResult{}, http.StatusInternalServerError, fmt.Errorf("describe group: %v", err)
+	}
+
+	result := s.newGroupDeletionResult(descriptions[0])
+	switch result.State {
+	case "Empty":
+		return result, http.StatusOK, nil
+	case "Dead":
+		return result, http.StatusNotFound, fmt.Errorf("group not found")
+	default:
+		return result, http.StatusConflict, fmt.Errorf("group is %s; only Empty groups can be changed", result.State)
+	}
+}
+
+func (s *Server) newGroupDeletionResult(description *sarama.GroupDescription) GroupDeletionResult {
+	result := GroupDeletionResult{Group: description.GroupId, State: description.State}
+	if observed, ok := s.groupStates.get(description.GroupId); ok && observed.State == "Empty" {
+		since := observed.Since
+		result.EmptySince = &since
+	}
+	return result
+}
+
+// deleteConsumerGroups deletes every group matching the pattern that has
+// been Empty for at least EmptyFor. Groups in any other state are skipped.
+func (s *Server) deleteConsumerGroups(w http.ResponseWriter, r *http.Request) {
+	var req GroupBulkDeletion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Pattern == "" {
+		http.Error(w, "Pattern not specified", http.StatusBadRequest)
+		return
+	}
+	pattern, err := regexp.Compile("^(?:" + req.Pattern + ")$")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid pattern: %v", err), http.StatusBadRequest)
+		return
+	}
+	emptyFor, err := time.ParseDuration(req.EmptyFor)
+	if err != nil || emptyFor < 0 {
+		http.Error(w, fmt.Sprintf("Invalid emptyFor %q; use a duration such as 24h", req.EmptyFor), http.StatusBadRequest)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	groups, err := admin.ListConsumerGroups()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list consumer groups: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var matched []string
+	for group := range groups {
+		if pattern.MatchString(group) {
+			matched = append(matched, group)
+		}
+	}
+	descriptions, err := s.describeGroups(admin, matched)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe consumer groups: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := GroupDeletionResponse{DryRun: req.DryRun, Results: []GroupDeletionResult{}}
+	now := time.Now()
+	for _, description := range descriptions {
+		result := s.newGroupDeletionResult(description)
+		switch {
+		case result.State != "Empty":
+			result.Status = "skipped"
+			result.Reason = fmt.Sprintf("group is %s", result.State)
+		case result.EmptySince == nil || now.Sub(*result.EmptySince) < emptyFor:
+			result.Status = "skipped"
+			result.Reason = "not Empty for long enough"
+			if started := s.groupStates.started; now.Sub(started) < emptyFor {
+				result.Reason = fmt.Sprintf("not Empty for long enough; group states are only known since the dashboard started at %s", started.Format(time.RFC3339))
+			}
+		case req.DryRun:
+			result.Status = "would-delete"
+		default:
+			if err := admin.DeleteConsumerGroup(result.Group); err != nil {
+				result.Status = "failed"
+				result.Reason = err.Error()
+			} else {
+				result.Status = "deleted"
+			}
+		}
+		response.Results = append(response.Results, result)
+	}
+	sort.Slice(response.Results, func(i, j int) bool { return response.Results[i].Group < response.Results[j].Group })
+	if !req.DryRun {
+		s.groupCache.invalidate()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
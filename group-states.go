@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// observedGroupState is the last state seen for a consumer group and when
+// the group was first seen in it.
+type observedGroupState struct {
+	State string
+	Since time.Time
+}
+
+// groupStateTracker remembers when each consumer group entered its current
+// state. Kafka doesn't expose this, so it is only known from the moment the
+// dashboard first saw the group in that state, and states aren't kept
+// across restarts.
+type groupStateTracker struct {
+	mu      sync.Mutex
+	groups  map[string]observedGroupState
+	started time.Time
+}
+
+func newGroupStateTracker() *groupStateTracker {
+	return &groupStateTracker{groups: make(map[string]observedGroupState), started: time.Now()}
+}
+
+func (t *groupStateTracker) observe(group, state string, now time.Time) observedGroupState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	observed, ok := t.groups[group]
+	if !ok || observed.State != state {
+		observed = observedGroupState{State: state, Since: now}
+		t.groups[group] = observed
+	}
+	return observed
+}
+
+// forget drops groups that no longer exist.
+func (t *groupStateTracker) forget(keep map[string]*sarama.GroupDescription) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for group := range t.groups {
+		if _, ok := keep[group]; !ok {
+			delete(t.groups, group)
+		}
+	}
+}
+
+func (t *groupStateTracker) get(group string) (observedGroupState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	observed, ok := t.groups[group]
+	return observed, ok
+}
+
+// trackGroupStates describes every consumer group on each interval so
+// group states and rebalances are observed even when nobody is looking at
+// them.
+func (s *Server) trackGroupStates(interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Groups are only forgotten after a complete refresh, so one that
+		// was briefly unreachable keeps its history.
+		if descriptions, failed, err := s.groupCache.refresh(); err != nil {
+			log.Println("Failed to observe consumer group states:", err)
+		} else if len(failed) == 0 {
+			s.groupStates.forget(descriptions)
+			s.rebalances.forget(descriptions, time.Now())
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// describeGroups describes groups and records the state of each.
+func (s *Server) describeGroups(admin sarama.ClusterAdmin, groups []string) ([]*sarama.GroupDescription, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	descriptions, err := admin.DescribeConsumerGroups(groups)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, description := range descriptions {
+		s.groupStates.observe(description.GroupId, description.State, now)
+	}
+	return descriptions, nil
+}
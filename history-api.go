@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordHistory samples cluster and topic metrics into the history store
+// every resolution step until the server is closed.
+func (s *Server) recordHistory(resolution time.Duration) {
+	if resolution <= 0 {
+		resolution = 10 * time.Second
+	}
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.recordHistorySample(time.Now())
+		}
+	}
+}
+
+func (s *Server) recordHistorySample(now time.Time) {
+	latest := s.sampler.LatestOffsets()
+	for topic, partitions := range latest {
+		s.history.Record(MetricTopicThroughput, map[string]string{"topic": topic},
+			s.sampler.Throughput(topic).Rates.OneMinute, now)
+
+		// Every partition is its own series of about 60 KB with the default
+		// tiers, so these are only kept when asked for.
+		if !s.config.HistoryPartitionOffsets {
+			continue
+		}
+		for partition, offset := range partitions {
+			s.history.Record(MetricPartitionOffset, map[string]string{
+				"topic":     topic,
+				"partition": strconv.Itoa(int(partition)),
+			}, float64(offset), now)
+		}
+	}
+
+	// Broker and partition counts come from the refresher's snapshot, and
+	// aren't recorded while it is stale.
+	if status := s.currentClusterStatus(); !status.Stale {
+		s.history.Record(MetricBrokerCount, nil, float64(len(status.Brokers)), now)
+		if status.Health != nil {
+			s.history.Record(MetricUnderReplicatedPartitions, nil, float64(status.Health.UnderReplicated), now)
+		}
+	}
+
+	s.recordConsumerLagHistory(latest, now)
+}
+
+// recordConsumerLagHistory records the lag of every group on every topic it
+// has committed on, using the group cache's committed offsets and the
+// sampler's end offsets.
+func (s *Server) recordConsumerLagHistory(latest map[string]map[int32]int64, now time.Time) {
+	if s.groupCache == nil {
+		return
+	}
+
+	groups, err := s.groupCache.committedOffsets()
+	if err != nil {
+		log.Println("History: failed to fetch committed offsets:", err)
+		return
+	}
+
+	for group, topics := range groups {
+		for topic, partitions := range topics {
+			endOffsets, ok := latest[topic]
+			if !ok || len(partitions) == 0 {
+				continue
+			}
+
+			var lag int64
+			for partition, offset := range partitions {
+				lag += offsetLag(endOffsets[partition], offset)
+			}
+			s.history.Record(MetricConsumerLag, map[string]string{
+				"group": group,
+				"topic": topic,
+			}, float64(lag), now)
+		}
+	}
+}
+
+// serveHistory answers /history?metric=&labels=k=v,k=v&from=&to=&step=.
+// from and to accept RFC 3339 or Unix seconds; range (such as 1h, 1d or 1w)
+// can be given instead of from.
+func (s *Server) serveHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	metric := query.Get("metric")
+	if metric == "" {
+		http.Error(w, "metric is required", http.StatusBadRequest)
+		return
+	}
+
+	labels := make(map[string]string)
+	if raw := query.Get("labels"); raw != "" {
+		for _, pair := range strings.Split(raw, ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				http.Error(w, fmt.Sprintf("Invalid label %q, expected name=value", pair), http.StatusBadRequest)
+				return
+			}
+			labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	now := time.Now()
+	to := now
+	if raw := query.Get("to"); raw != "" {
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid to: %v", err), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-time.Hour)
+	if raw := query.Get("from"); raw != "" {
+		t, err := parseHistoryTime(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid from: %v", err), http.StatusBadRequest)
+			return
+		}
+		from = t
+	} else if raw := query.Get("range"); raw != "" {
+		d, err := parseHistoryDuration(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid range: %v", err), http.StatusBadRequest)
+			return
+		}
+		from = to.Add(-d)
+	}
+
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	// Default to roughly 300 points per series.
+	step := to.Sub(from) / 300
+	if raw := query.Get("step"); raw != "" {
+		d, err := parseHistoryDuration(raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid step: %v", err), http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+
+	response := map[string]interface{}{
+		"metric": metric,
+		"from":   from.Unix(),
+		"to":     to.Unix(),
+		"series": s.history.Query(metric, labels, from, to, step),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func parseHistoryTime(raw string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// parseHistoryDuration extends time.ParseDuration with d (day) and w (week)
+// suffixes.
+func parseHistoryDuration(raw string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(raw, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", raw)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(raw)
+}
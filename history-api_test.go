@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordHistorySample(t *testing.T) {
+	s, source := newFakeServer(t)
+	setTopic(source, inventoryTopic)
+	source.SetBrokers(testBrokers(1, 2))
+	s.sampler.sample()
+
+	now := time.Now()
+	s.recordHistorySample(now)
+
+	latest := func(metric string, labels map[string]string) []HistorySeriesResult {
+		return s.history.Query(metric, labels, now.Add(-time.Minute), now.Add(time.Minute), 0)
+	}
+	value := func(metric string) float64 {
+		t.Helper()
+		series := latest(metric, nil)
+		if len(series) != 1 || len(series[0].Points) == 0 {
+			t.Fatalf("%s: got %+v, want one series", metric, series)
+		}
+		points := series[0].Points
+		return points[len(points)-1][1]
+	}
+
+	if got := value(MetricBrokerCount); got != 2 {
+		t.Errorf("broker count = %v, want 2", got)
+	}
+	if got := value(MetricUnderReplicatedPartitions); got != 1 {
+		t.Errorf("under-replicated partitions = %v, want 1", got)
+	}
+	if series := latest(MetricTopicThroughput, map[string]string{"topic": "inventory"}); len(series) != 1 {
+		t.Errorf("topic throughput: got %d series, want 1", len(series))
+	}
+	if series := latest(MetricPartitionOffset, nil); len(series) != 0 {
+		t.Errorf("partition offsets recorded without HistoryPartitionOffsets: %+v", series)
+	}
+
+	s.config.HistoryPartitionOffsets = true
+	s.recordHistorySample(now)
+	if series := latest(MetricPartitionOffset, map[string]string{"topic": "inventory"}); len(series) != 2 {
+		t.Errorf("partition offsets: got %d series, want 2", len(series))
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names recorded in the history store.
+const (
+	MetricTopicThroughput           = "topic_throughput"
+	MetricConsumerLag               = "consumer_lag"
+	MetricPartitionOffset           = "partition_offset"
+	MetricBrokerCount               = "broker_count"
+	MetricUnderReplicatedPartitions = "under_replicated_partitions"
+)
+
+const historyFile = "history.gob"
+
+// historyTier stores every series at one resolution for one retention.
+// Finer tiers are kept for shorter periods, which is how older data is
+// downsampled.
+type historyTier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// historyBucket aggregates all samples that fell into one resolution step.
+type historyBucket struct {
+	Start int64
+	Sum   float64
+	Count int
+}
+
+type historySeries struct {
+	Metric  string
+	Labels  map[string]string
+	Buckets [][]historyBucket // one slice per tier
+}
+
+// HistoryPoint is one [timestamp, value] pair in a query result.
+type HistoryPoint [2]float64
+
+type HistorySeriesResult struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+	Points []HistoryPoint    `json:"points"`
+}
+
+// HistoryStore is an embedded time-series store. Samples are aggregated
+// into fixed-resolution tiers in memory and the whole store is periodically
+// snapshotted to a file in dir.
+type HistoryStore struct {
+	dir   string
+	tiers []historyTier
+
+	mu     sync.RWMutex
+	series map[string]*historySeries
+}
+
+// NewHistoryStore builds the tier layout from the base resolution and total
+// retention and loads any existing snapshot from dir. An empty dir keeps
+// history in memory only.
+func NewHistoryStore(dir string, resolution, retention time.Duration) (*HistoryStore, error) {
+	if resolution <= 0 {
+		resolution = 10 * time.Second
+	}
+	if retention <= 0 {
+		retention = 7 * 24 * time.Hour
+	}
+
+	tiers := []historyTier{
+		{Resolution: resolution, Retention: time.Hour},
+		{Resolution: maxDuration(resolution, time.Minute), Retention: 24 * time.Hour},
+		{Resolution: maxDuration(resolution, 15*time.Minute), Retention: retention},
+	}
+	for i := range tiers {
+		if tiers[i].Retention > retention {
+			tiers[i].Retention = retention
+		}
+	}
+
+	store := &HistoryStore{
+		dir:    dir,
+		tiers:  tiers,
+		series: make(map[string]*historySeries),
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := store.load(); err != nil {
+			log.Printf("Failed to load history from %s, starting empty: %v", dir, err)
+		}
+		store.expire(time.Now())
+	}
+
+	return store, nil
+}
+
+// Record adds a sample to every tier of the series identified by metric and
+// labels.
+func (h *HistoryStore) Record(metric string, labels map[string]string, value float64, t time.Time) {
+	key := seriesKey(metric, labels)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &historySeries{
+			Metric:  metric,
+			Labels:  labels,
+			Buckets: make([][]historyBucket, len(h.tiers)),
+		}
+		h.series[key] = series
+	}
+
+	for i, tier := range h.tiers {
+		start := t.Truncate(tier.Resolution).Unix()
+		buckets := series.Buckets[i]
+
+		if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+			buckets[n-1].Sum += value
+			buckets[n-1].Count++
+		} else {
+			buckets = append(buckets, historyBucket{Start: start, Sum: value, Count: 1})
+		}
+
+		series.Buckets[i] = trimBuckets(buckets, t.Add(-tier.Retention))
+	}
+}
+
+// expire trims every series against now and drops those with nothing
+// left. Record only trims series that still receive samples, so this is
+// what expires those of deleted topics or groups.
+func (h *HistoryStore) expire(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key, series := range h.series {
+		empty := true
+		for i, tier := range h.tiers {
+			series.Buckets[i] = trimBuckets(series.Buckets[i], now.Add(-tier.Retention))
+			if len(series.Buckets[i]) > 0 {
+				empty = false
+			}
+		}
+		if empty {
+			delete(h.series, key)
+		}
+	}
+}
+
+// trimBuckets drops the buckets that start before cutoff.
+func trimBuckets(buckets []historyBucket, cutoff time.Time) []historyBucket {
+	trim := 0
+	for trim < len(buckets) && buckets[trim].Start < cutoff.Unix() {
+		trim++
+	}
+	return buckets[trim:]
+}
+
+// Query returns every series of metric whose labels include all of
+// matchLabels, averaged into step-sized points between from and to. It reads
+// the finest tier that still covers from.
+func (h *HistoryStore) Query(metric string, matchLabels map[string]string, from, to time.Time, step time.Duration) []HistorySeriesResult {
+	tierIndex := len(h.tiers) - 1
+	for i, tier := range h.tiers {
+		if time.Since(from) <= tier.Retention {
+			tierIndex = i
+			break
+		}
+	}
+	if step < h.tiers[tierIndex].Resolution {
+		step = h.tiers[tierIndex].Resolution
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	results := []HistorySeriesResult{}
+	for _, series := range h.series {
+		if series.Metric != metric || !labelsMatch(series.Labels, matchLabels) {
+			continue
+		}
+
+		var points []HistoryPoint
+		var current historyBucket
+		current.Start = -1
+		for _, bucket := range series.Buckets[tierIndex] {
+			if bucket.Start < from.Unix() || bucket.Start > to.Unix() {
+				continue
+			}
+
+			start := time.Unix(bucket.Start, 0).Truncate(step).Unix()
+			if start != current.Start && current.Count > 0 {
+				points = append(points, HistoryPoint{float64(current.Start), current.Sum / float64(current.Count)})
+				current = historyBucket{}
+			}
+			current.Start = start
+			current.Sum += bucket.Sum
+			current.Count += bucket.Count
+		}
+		if current.Count > 0 {
+			points = append(points, HistoryPoint{float64(current.Start), current.Sum / float64(current.Count)})
+		}
+
+		if points == nil {
+			points = []HistoryPoint{}
+		}
+		results = append(results, HistorySeriesResult{
+			Metric: series.Metric,
+			Labels: series.Labels,
+			Points: points,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return seriesKey(results[i].Metric, results[i].Labels) < seriesKey(results[j].Metric, results[j].Labels)
+	})
+	return results
+}
+
+// Run expires old samples and snapshots the store to disk every interval,
+// and saves once more when done is closed. Without a dir nothing is saved.
+func (h *HistoryStore) Run(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			h.save()
+			return
+		case <-ticker.C:
+			h.expire(time.Now())
+			h.save()
+		}
+	}
+}
+
+func (h *HistoryStore) save() {
+	if h.dir == "" {
+		return
+	}
+	if err := h.Save(); err != nil {
+		log.Println("Failed to save history:", err)
+	}
+}
+
+// Save writes the store to a temporary file and renames it into place so a
+// crash never leaves a truncated snapshot.
+func (h *HistoryStore) Save() error {
+	tmp, err := os.CreateTemp(h.dir, historyFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h.mu.RLock()
+	err = gob.NewEncoder(tmp).Encode(h.series)
+	h.mu.RUnlock()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(h.dir, historyFile))
+}
+
+func (h *HistoryStore) load() error {
+	f, err := os.Open(filepath.Join(h.dir, historyFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	series := make(map[string]*historySeries)
+	if err := gob.NewDecoder(f).Decode(&series); err != nil {
+		return err
+	}
+
+	// Drop tiers that no longer exist if the layout changed between runs.
+	for _, s := range series {
+		buckets := make([][]historyBucket, len(h.tiers))
+		copy(buckets, s.Buckets)
+		s.Buckets = buckets
+	}
+
+	h.mu.Lock()
+	h.series = series
+	h.mu.Unlock()
+	return nil
+}
+
+func seriesKey(metric string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(metric)
+	for _, name := range names {
+		fmt.Fprintf(&key, ",%s=%s", name, labels[name])
+	}
+	return key.String()
+}
+
+func labelsMatch(labels, match map[string]string) bool {
+	for name, value := range match {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job states.
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// jobRetention is how long finished jobs, and any files they produced, are
+// kept before they are forgotten.
+const jobRetention = time.Hour
+
+// Job is a snapshot of a background task such as an export.
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	State      string      `json:"state"`
+	Processed  int64       `json:"processed"`
+	Total      int64       `json:"total"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// JobProgress is handed to a running job to report how far it got.
+type JobProgress struct {
+	processed atomic.Int64
+	total     atomic.Int64
+}
+
+func (p *JobProgress) SetTotal(total int64) { p.total.Store(total) }
+func (p *JobProgress) Set(processed int64)  { p.processed.Store(processed) }
+func (p *JobProgress) Add(n int64)          { p.processed.Add(n) }
+
+// JobFunc does the work of a job. It must return promptly once ctx is
+// cancelled. The result is reported with the job when it completes.
+type JobFunc func(ctx context.Context, progress *JobProgress) (interface{}, error)
+
+type jobEntry struct {
+	job      Job
+	progress *JobProgress
+	cancel   context.CancelFunc
+	cleanup  func()
+}
+
+// JobManager runs jobs in the background and keeps their state for
+// polling.
+type JobManager struct {
+	mu   sync.Mutex
+	jobs map[string]*jobEntry
+}
+
+func NewJobManager() *JobManager {
+	return &JobManager{jobs: make(map[string]*jobEntry)}
+}
+
+// Start runs fn in a new goroutine. cleanup, if not nil, is called when the
+// finished job is forgotten, e.g. to remove a file it wrote.
+func (m *JobManager) Start(jobType string, fn JobFunc, cleanup func()) Job {
+	return m.StartWithID(newJobID(), jobType, fn, cleanup)
+}
+
+// StartWithID is Start for callers that need the job's ID, from newJobID,
+// before it starts running.
+func (m *JobManager) StartWithID(id, jobType string, fn JobFunc, cleanup func()) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &jobEntry{
+		job: Job{
+			ID:        id,
+			Type:      jobType,
+			State:     JobRunning,
+			CreatedAt: time.Now(),
+		},
+		progress: &JobProgress{},
+		cancel:   cancel,
+		cleanup:  cleanup,
+	}
+
+	m.mu.Lock()
+	m.prune()
+	m.jobs[entry.job.ID] = entry
+	job := m.snapshot(entry)
+	m.mu.Unlock()
+
+	go func() {
+		result, err := fn(ctx, entry.progress)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		now := time.Now()
+		entry.job.FinishedAt = &now
+		entry.job.Result = result
+		switch {
+		case ctx.Err() != nil:
+			entry.job.State = JobCancelled
+		case err != nil:
+			entry.job.State = JobFailed
+			entry.job.Error = err.Error()
+			log.Printf("Job %s (%s) failed: %v", entry.job.ID, jobType, err)
+		default:
+			entry.job.State = JobCompleted
+		}
+		cancel()
+	}()
+
+	return job
+}
+
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return m.snapshot(entry), true
+}
+
+func (m *JobManager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, entry := range m.jobs {
+		jobs = append(jobs, m.snapshot(entry))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// Cancel stops a running job. It reports false if the job doesn't exist.
+func (m *JobManager) Cancel(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.jobs[id]
+	if ok {
+		entry.cancel()
+	}
+	return ok
+}
+
+// CancelAll stops every running job, for shutdown.
+func (m *JobManager) CancelAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.jobs {
+		entry.cancel()
+	}
+}
+
+// snapshot copies a job with its current progress. Callers must hold m.mu.
+func (m *JobManager) snapshot(entry *jobEntry) Job {
+	job := entry.job
+	job.Processed = entry.progress.processed.Load()
+	job.Total = entry.progress.total.Load()
+	return job
+}
+
+// prune forgets jobs that finished more than jobRetention ago. Callers must
+// hold m.mu.
+func (m *JobManager) prune() {
+	for id, entry := range m.jobs {
+		if entry.job.FinishedAt != nil && time.Since(*entry.job.FinishedAt) > jobRetention {
+			if entry.cleanup != nil {
+				entry.cleanup()
+			}
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) serveJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.jobs.List())
+}
+
+func (s *Server) serveJob(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := s.jobs.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request, id string) {
+	if !s.jobs.Cancel(id) {
+		http.Error(w, fmt.Sprintf("Job %s not found", id), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+// BrokerLeadership compares how many partitions a broker leads with how
+// many it is the preferred leader of. SkewPercent is how far the former is
+// above (or below) the latter.
+type BrokerLeadership struct {
+	Broker      int32   `json:"broker"`
+	Leading     int     `json:"leading"`
+	Preferred   int     `json:"preferred"`
+	SkewPercent float64 `json:"skewPercent"`
+}
+
+// MisledPartition is a partition that isn't led by its preferred leader.
+// PreferredInSync says whether a preferred election could move it back.
+type MisledPartition struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	Leader          int32  `json:"leader"`
+	PreferredLeader int32  `json:"preferredLeader"`
+	PreferredInSync bool   `json:"preferredInSync"`
+}
+
+// LeaderReport is the leader balance of a cluster. ImbalancePercent is the
+// share of partitions not led by their preferred leader; offline
+// partitions have no leader at all.
+type LeaderReport struct {
+	Partitions       int                `json:"partitions"`
+	NotPreferred     int                `json:"notPreferred"`
+	ImbalancePercent float64            `json:"imbalancePercent"`
+	Brokers          []BrokerLeadership `json:"brokers"`
+	Misled           []MisledPartition  `json:"misled"`
+	Offline          []TopicPartition   `json:"offline"`
+}
+
+type TopicPartition struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+}
+
+func leaderReport(topics []TopicMetadata, brokers []BrokerInfo) *LeaderReport {
+	report := &LeaderReport{Misled: []MisledPartition{}, Offline: []TopicPartition{}}
+	leadership := make(map[int32]*BrokerLeadership, len(brokers))
+	broker := func(id int32) *BrokerLeadership {
+		if _, ok := leadership[id]; !ok {
+			leadership[id] = &BrokerLeadership{Broker: id}
+		}
+		return leadership[id]
+	}
+	for _, b := range brokers {
+		broker(b.ID)
+	}
+
+	for _, topic := range topics {
+		for _, partition := range topic.Partitions {
+			report.Partitions++
+			if len(partition.Replicas) == 0 {
+				continue
+			}
+			preferred := partition.Replicas[0]
+			broker(preferred).Preferred++
+
+			if partition.Leader < 0 {
+				report.NotPreferred++
+				report.Offline = append(report.Offline, TopicPartition{topic.Name, partition.ID})
+				continue
+			}
+			broker(partition.Leader).Leading++
+			if partition.Leader != preferred {
+				report.NotPreferred++
+				report.Misled = append(report.Misled, MisledPartition{
+					Topic:           topic.Name,
+					Partition:       partition.ID,
+					Leader:          partition.Leader,
+					PreferredLeader: preferred,
+					PreferredInSync: slices.Contains(partition.ISR, preferred),
+				})
+			}
+		}
+	}
+
+	if report.Partitions > 0 {
+		report.ImbalancePercent = float64(report.NotPreferred) / float64(report.Partitions) * 100
+	}
+	for _, b := range leadership {
+		switch {
+		case b.Preferred > 0:
+			b.SkewPercent = float64(b.Leading-b.Preferred) / float64(b.Preferred) * 100
+		case b.Leading > 0:
+			b.SkewPercent = 100
+		}
+		report.Brokers = append(report.Brokers, *b)
+	}
+	sort.Slice(report.Brokers, func(i, j int) bool { return report.Brokers[i].Broker < report.Brokers[j].Broker })
+	return report
+}
+
+func (s *Server) serveLeaderReport(w http.ResponseWriter, r *http.Request) {
+	topics, err := s.source.ListTopics()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list topics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	metadata, err := s.source.DescribeTopics(topics)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe topics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	brokers, err := s.source.ListBrokers()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list brokers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaderReport(metadata, brokers))
+}
+
+// LeaderElectionRequest is the body of POST /leaders/elect. Type is
+// "preferred" (the default) or "unclean". Without Partitions, a preferred
+// election covers every partition not led by its preferred leader and an
+// unclean election covers every offline partition. An unclean election can
+// lose committed records, so it needs ConfirmUnclean.
+type LeaderElectionRequest struct {
+	Type           string           `json:"type"`
+	Partitions     []TopicPartition `json:"partitions"`
+	ConfirmUnclean bool             `json:"confirmUnclean"`
+}
+
+// ElectionResult is the outcome for one partition: "elected", "not-needed"
+// when the partition already had a suitable leader, or "failed".
+type ElectionResult struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+type LeaderElectionResponse struct {
+	Type    string           `json:"type"`
+	Results []ElectionResult `json:"results"`
+}
+
+func (s *Server) electLeaders(w http.ResponseWriter, r *http.Request) {
+	var req LeaderElectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var electionType sarama.ElectionType
+	switch req.Type {
+	case "", "preferred":
+		req.Type = "preferred"
+		electionType = sarama.PreferredElection
+	case "unclean":
+		if !req.ConfirmUnclean {
+			http.Error(w, "Unclean leader election can lose committed records; set confirmUnclean to proceed", http.StatusBadRequest)
+			return
+		}
+		electionType = sarama.UncleanElection
+	default:
+		http.Error(w, fmt.Sprintf("Unknown election type %q", req.Type), http.StatusBadRequest)
+		return
+	}
+
+	targets := req.Partitions
+	if len(targets) == 0 {
+		topics, err := s.source.ListTopics()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list topics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		metadata, err := s.source.DescribeTopics(topics)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to describe topics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		report := leaderReport(metadata, nil)
+		if electionType == sarama.UncleanElection {
+			targets = report.Offline
+		} else {
+			for _, partition := range report.Misled {
+				targets = append(targets, TopicPartition{partition.Topic, partition.Partition})
+			}
+		}
+	}
+
+	response := LeaderElectionResponse{Type: req.Type, Results: []ElectionResult{}}
+	if len(targets) > 0 {
+		partitions := make(map[string][]int32)
+		seen := make(map[TopicPartition]bool, len(targets))
+		unique := make([]TopicPartition, 0, len(targets))
+		for _, target := range targets {
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			unique = append(unique, target)
+			partitions[target.Topic] = append(partitions[target.Topic], target.Partition)
+		}
+		targets = unique
+
+		admin, err := s.newClusterAdmin()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+			return
+		}
+		defer admin.Close()
+
+		results, err := admin.ElectLeaders(electionType, partitions)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to elect leaders: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, target := range targets {
+			result := ElectionResult{Topic: target.Topic, Partition: target.Partition, Status: "elected"}
+			switch partition := results[target.Topic][target.Partition]; {
+			case partition == nil:
+				result.Status = "failed"
+				result.Error = "no result returned by the controller"
+			case errors.Is(partition.ErrorCode, sarama.ErrElectionNotNeeded):
+				result.Status = "not-needed"
+			case !errors.Is(partition.ErrorCode, sarama.ErrNoError):
+				result.Status = "failed"
+				result.Error = partition.ErrorCode.Error()
+				if partition.ErrorMessage != nil && *partition.ErrorMessage != "" {
+					result.Error = *partition.ErrorMessage
+				}
+			}
+			response.Results = append(response.Results, result)
+		}
+		s.kafkaConn.RefreshMetadata()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
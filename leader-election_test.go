@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// ordersTopic has a partition led by its preferred leader, one led by its
+// second replica and one without a leader.
+var ordersTopic = TopicMetadata{
+	Name: "orders",
+	Partitions: []PartitionMetadata{
+		{ID: 0, Leader: 1, Replicas: []int32{1, 2}, ISR: []int32{1, 2}},
+		{ID: 1, Leader: 1, Replicas: []int32{2, 1}, ISR: []int32{2, 1}},
+		{ID: 2, Leader: -1, Replicas: []int32{3, 1}, ISR: []int32{}},
+	},
+}
+
+func TestLeaderReport(t *testing.T) {
+	report := leaderReport([]TopicMetadata{ordersTopic}, testBrokers(1, 2, 3))
+
+	if report.Partitions != 3 || report.NotPreferred != 2 {
+		t.Errorf("got %d partitions, %d not preferred; want 3, 2", report.Partitions, report.NotPreferred)
+	}
+	if math.Abs(report.ImbalancePercent-200.0/3) > 1e-9 {
+		t.Errorf("ImbalancePercent = %v, want %v", report.ImbalancePercent, 200.0/3)
+	}
+
+	wantBrokers := []BrokerLeadership{
+		{Broker: 1, Leading: 2, Preferred: 1, SkewPercent: 100},
+		{Broker: 2, Leading: 0, Preferred: 1, SkewPercent: -100},
+		{Broker: 3, Leading: 0, Preferred: 1, SkewPercent: -100},
+	}
+	if !reflect.DeepEqual(report.Brokers, wantBrokers) {
+		t.Errorf("Brokers = %+v, want %+v", report.Brokers, wantBrokers)
+	}
+
+	wantMisled := []MisledPartition{{Topic: "orders", Partition: 1, Leader: 1, PreferredLeader: 2, PreferredInSync: true}}
+	if !reflect.DeepEqual(report.Misled, wantMisled) {
+		t.Errorf("Misled = %+v, want %+v", report.Misled, wantMisled)
+	}
+	wantOffline := []TopicPartition{{Topic: "orders", Partition: 2}}
+	if !reflect.DeepEqual(report.Offline, wantOffline) {
+		t.Errorf("Offline = %+v, want %+v", report.Offline, wantOffline)
+	}
+}
+
+func TestLeaderReportLeaderWithoutPreferredPartitions(t *testing.T) {
+	topic := TopicMetadata{
+		Name:       "audit",
+		Partitions: []PartitionMetadata{{ID: 0, Leader: 2, Replicas: []int32{1, 2}, ISR: []int32{2}}},
+	}
+	report := leaderReport([]TopicMetadata{topic}, testBrokers(1, 2))
+
+	want := []BrokerLeadership{
+		{Broker: 1, Leading: 0, Preferred: 1, SkewPercent: -100},
+		{Broker: 2, Leading: 1, Preferred: 0, SkewPercent: 100},
+	}
+	if !reflect.DeepEqual(report.Brokers, want) {
+		t.Errorf("Brokers = %+v, want %+v", report.Brokers, want)
+	}
+	if len(report.Misled) != 1 || report.Misled[0].PreferredInSync {
+		t.Errorf("Misled = %+v, want one partition whose preferred leader is out of sync", report.Misled)
+	}
+}
+
+func TestLeaderReportEmptyCluster(t *testing.T) {
+	report := leaderReport(nil, nil)
+	if report.Partitions != 0 || report.ImbalancePercent != 0 || report.Misled == nil || report.Offline == nil {
+		t.Errorf("got %+v, want an empty report with empty lists", report)
+	}
+}
+
+func TestServeLeaderReport(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2, 3))
+	setTopic(source, ordersTopic)
+
+	var report LeaderReport
+	getJSON(t, s, "/leaders", &report)
+	if report.Partitions != 3 || report.NotPreferred != 2 || len(report.Misled) != 1 || len(report.Offline) != 1 {
+		t.Errorf("got %+v", report)
+	}
+}
@@ -0,0 +1,110 @@
+import { useState, useEffect } from 'react';
+import { Line } from 'react-chartjs-2';
+import { Box, Card, CardContent, CardHeader, ToggleButton, ToggleButtonGroup, LinearProgress, Typography, useTheme } from '@mui/material';
+import { API_URL } from './config';
+
+const RANGES = ['1h', '1d', '1w'];
+
+const fetchHistory = async (metric, labels, range) => {
+    const params = new URLSearchParams({ metric, labels, range });
+    const response = await fetch(`${API_URL}/history?${params}`);
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return response.json();
+};
+
+const formatTime = (seconds, range) => {
+    const date = new Date(seconds * 1000);
+    return range === '1h' ? date.toLocaleTimeString() : date.toLocaleString();
+};
+
+const HistoryChart = ({ topic }) => {
+    const theme = useTheme();
+    const [range, setRange] = useState('1h');
+    const [chartData, setChartData] = useState(null);
+    const [error, setError] = useState(null);
+
+    useEffect(() => {
+        let cancelled = false;
+
+        const load = async () => {
+            try {
+                const [throughput, lag] = await Promise.all([
+                    fetchHistory('topic_throughput', `topic=${topic}`, range),
+                    fetchHistory('consumer_lag', `topic=${topic}`, range),
+                ]);
+                if (cancelled) return;
+
+                const throughputPoints = throughput.series[0]?.points || [];
+                const datasets = [{
+                    label: 'Throughput (msg/s)',
+                    data: throughputPoints.map(([t, v]) => ({ x: formatTime(t, range), y: v })),
+                    borderColor: 'rgba(75, 192, 192, 1)',
+                    backgroundColor: 'rgba(75, 192, 192, 0.2)',
+                    yAxisID: 'y',
+                }];
+                lag.series.forEach((series) => {
+                    datasets.push({
+                        label: `Lag: ${series.labels.group}`,
+                        data: series.points.map(([t, v]) => ({ x: formatTime(t, range), y: v })),
+                        borderColor: 'rgba(255, 99, 132, 1)',
+                        backgroundColor: 'rgba(255, 99, 132, 0.2)',
+                        yAxisID: 'lag',
+                    });
+                });
+
+                setChartData({ datasets });
+                setError(null);
+            } catch (err) {
+                if (!cancelled) setError(err.message);
+            }
+        };
+
+        load();
+        const interval = setInterval(load, 30000);
+        return () => {
+            cancelled = true;
+            clearInterval(interval);
+        };
+    }, [topic, range]);
+
+    return (
+        <Card elevation={2} sx={{ mt: 4, backgroundColor: theme.palette.background.paper }}>
+            <CardHeader
+                title="History"
+                titleTypographyProps={{ variant: 'h6' }}
+                action={
+                    <ToggleButtonGroup size="small" exclusive value={range} onChange={(e, value) => value && setRange(value)}>
+                        {RANGES.map((r) => (
+                            <ToggleButton key={r} value={r}>{r}</ToggleButton>
+                        ))}
+                    </ToggleButtonGroup>
+                }
+            />
+            <CardContent>
+                <Box sx={{ height: '300px', display: 'flex', alignItems: 'center', justifyContent: 'center' }}>
+                    {error ? (
+                        <Typography color="error">{error}</Typography>
+                    ) : chartData ? (
+                        <Line
+                            data={chartData}
+                            options={{
+                                responsive: true,
+                                maintainAspectRatio: false,
+                                scales: {
+                                    y: { beginAtZero: true, position: 'left', title: { display: true, text: 'msg/s' } },
+                                    lag: { beginAtZero: true, position: 'right', title: { display: true, text: 'lag' }, grid: { drawOnChartArea: false } },
+                                },
+                            }}
+                        />
+                    ) : (
+                        <LinearProgress sx={{ width: '80%' }} />
+                    )}
+                </Box>
+            </CardContent>
+        </Card>
+    );
+};
+
+export default HistoryChart;
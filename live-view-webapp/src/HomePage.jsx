@@ -18,6 +18,7 @@ import {
     DragHandle as DragHandleIcon
 } from '@mui/icons-material';
 import KafkaGlobe from './KafkaGlobe';
+import { parseEnvelope, payloadValue } from './messageEnvelope';
 import { API_URL } from './config';
 
 // Resizable SidePanel component
@@ -129,7 +130,7 @@ const SidePanel = ({ children, side = 'left', initialWidth = 320 }) => {
 
 const ActivityItem = ({ message }) => {
     const theme = useTheme();
-    const data = typeof message === 'string' ? JSON.parse(message) : message;
+    const value = payloadValue(message.value);
     
     return (
         <Box sx={{ 
@@ -147,6 +148,11 @@ const ActivityItem = ({ message }) => {
                     : 'rgba(0,0,0,0.1)',
             }
         }}>
+            {message.offset !== undefined && (
+                <Typography variant="caption" color="text.secondary">
+                    p{message.partition} @ {message.offset}
+                </Typography>
+            )}
             <Typography 
                 variant="body2" 
                 component="pre" 
@@ -158,7 +164,7 @@ const ActivityItem = ({ message }) => {
                     fontSize: '0.75rem'
                 }}
             >
-                {JSON.stringify(data, null, 2)}
+                {typeof value === 'string' ? value : JSON.stringify(value, null, 2)}
             </Typography>
         </Box>
     );
@@ -217,13 +223,7 @@ const HomePage = () => {
         ws.onclose = () => console.log('WebSocket connection closed');
         
         ws.onmessage = (event) => {
-            try {
-                const data = JSON.parse(event.data);
-                setMessages(prev => [...prev, data]);
-            } catch (error) {
-                console.error('Error parsing message:', error);
-                setMessages(prev => [...prev, event.data]);
-            }
+            setMessages(prev => [...prev, parseEnvelope(event.data)]);
         };
 
         handleRefresh();
@@ -3,6 +3,7 @@ import * as THREE from 'three';
 import { OrbitControls } from 'three/examples/jsm/controls/OrbitControls';
 import { Box } from '@mui/material';
 import { useTheme } from '@mui/material/styles';
+import { payloadValue } from './messageEnvelope';
 
 const GLOBE_RADIUS = 1.3;
 const CURVE_SEGMENTS = 256; // Increased for smoother curves
@@ -402,7 +403,8 @@ const KafkaGlobe = ({ messages }) => {
             const kafkaLocation = { lat: 52.5200, lon: 13.4050 }; // Berlin (central hub)
 
             const message = messages[messages.length - 1];
-            const source = typeof message === 'string' ? JSON.parse(message).source : message.source;
+            const value = payloadValue(message.value);
+            const source = value && typeof value === 'object' ? value.source : undefined;
             
             // Always send to/from the Kafka broker location
             const startLoc = sourceLocations[source] || kafkaLocation;
@@ -90,7 +90,8 @@ const KafkaTopicTable = ({ topics, searchTerm, onRowClick, onDeleteTopic }) => {
             valueFormatter: (params) => params.value.toLocaleString()
         },
         { 
-            field: 'Lag', 
+            field: 'TotalLag', 
+            headerName: 'Lag',
             sortable: true, 
             filter: true, 
             resizable: true,
@@ -48,6 +48,8 @@ import {
 } from '@mui/material';
 import { Delete, Add, Edit, Refresh, DarkMode, LightMode, Speed, Message, Memory, Storage } from '@mui/icons-material';
 import KafkaTopicTable from './KafkaTopicTable';
+import HistoryChart from './HistoryChart';
+import { parseEnvelope, payloadText, payloadValue, matchesHeaderFilter } from './messageEnvelope';
 import { API_URL } from './config';
 import { useColorMode } from './ThemeContext';
 
@@ -81,19 +83,15 @@ const MessageActivityHeatmap = ({ messages }) => {
         // Fill with message count based on their timestamp
         messages.forEach(msg => {
             try {
-                // Assume message format includes a timestamp in first 30 chars
-                const msgText = typeof msg === 'string' ? msg : JSON.stringify(msg);
-                // Extract timestamp from message (simplified)
-                const dateMatch = msgText.match(/\d{4}-\d{2}-\d{2}/);
-                if (dateMatch) {
-                    const msgDate = new Date(dateMatch[0]);
+                if (msg.timestamp) {
+                    const msgDate = new Date(msg.timestamp);
                     const now = new Date();
                     const diffDays = Math.floor((now - msgDate) / (1000 * 60 * 60 * 24));
                     if (diffDays >= 0 && diffDays < days) {
                         data[days - diffDays - 1]++;
                     }
                 } else {
-                    // If no date format, just count as today
+                    // Records without a timestamp count as today
                     data[days - 1]++;
                 }
             } catch (e) {
@@ -170,29 +168,16 @@ const MessageVisualizer = ({ message, index }) => {
     const theme = useTheme();
     const isDarkMode = theme.palette.mode === 'dark';
     
-    // Try to detect if the message is JSON
-    const isJson = typeof message === 'string' && 
-        ((message.startsWith('{') && message.endsWith('}')) || 
-         (message.startsWith('[') && message.endsWith(']')));
-         
-    let parsedMessage = message;
-    let messageType = 'text';
-    
-    try {
-        if (isJson) {
-            parsedMessage = JSON.parse(message);
-            messageType = 'json';
-        }
-    } catch (e) {
-        // If parsing fails, keep as string
-    }
+    const value = payloadValue(message.value);
+    const messageType = value !== null && typeof value === 'object' ? 'json' : 'text';
+    const valueText = payloadText(message.value);
 
     return (
         <Box 
             sx={{ 
                 p: 1, 
                 borderLeft: '4px solid',
-                borderColor: stringToColor(typeof message === 'string' ? message : JSON.stringify(message)),
+                borderColor: stringToColor(valueText),
                 backgroundColor: isDarkMode ? '#2d2d2d' : '#f5f5f5',
                 borderRadius: '0 4px 4px 0',
                 mb: 1,
@@ -208,8 +193,28 @@ const MessageVisualizer = ({ message, index }) => {
                     color: isDarkMode ? '#aaa' : '#666' 
                 }}
             >
-                {new Date().toLocaleTimeString()} - Message #{index + 1}
+                {message.timestamp ? new Date(message.timestamp).toLocaleTimeString() : new Date().toLocaleTimeString()} - Message #{index + 1}
+                {message.offset !== undefined && ` - partition ${message.partition}, offset ${message.offset}`}
+                {message.key && ` - key ${payloadText(message.key)}`}
             </Typography>
+            {(message.headers?.length > 0 || message.value?.encoding === 'base64' || message.value?.format || message.value?.decodeError) && (
+                <Stack direction="row" spacing={0.5} sx={{ mb: 0.5, flexWrap: 'wrap' }}>
+                    {message.value?.format && (
+                        <Chip size="small" color="info" label={`${message.value.format} schema ${message.value.schemaId}`} />
+                    )}
+                    {message.value?.decodeError && (
+                        <MuiTooltip title={message.value.decodeError}>
+                            <Chip size="small" color="error" label="decode failed" />
+                        </MuiTooltip>
+                    )}
+                    {message.value?.encoding === 'base64' && (
+                        <Chip size="small" color="warning" label={`base64 ${message.value.contentType}`} />
+                    )}
+                    {(message.headers || []).map((header, idx) => (
+                        <Chip key={idx} size="small" variant="outlined" label={`${header.key}=${payloadText(header.value)}`} />
+                    ))}
+                </Stack>
+            )}
             
             {messageType === 'json' ? (
                 <pre style={{ 
@@ -218,7 +223,7 @@ const MessageVisualizer = ({ message, index }) => {
                     fontSize: '0.85rem',
                     color: isDarkMode ? '#0f0' : '#000',
                 }}>
-                    {JSON.stringify(parsedMessage, null, 2)}
+                    {JSON.stringify(value, null, 2)}
                 </pre>
             ) : (
                 <Typography 
@@ -228,7 +233,7 @@ const MessageVisualizer = ({ message, index }) => {
                         color: isDarkMode ? '#0f0' : '#000'
                     }}
                 >
-                    {message}
+                    {valueText}
                 </Typography>
             )}
         </Box>
@@ -243,6 +248,7 @@ const KafkaDashboard = () => {
     const [topicData, setTopicData] = useState([]);
     const [chartData, setChartData] = useState(null);
     const [topicLogs, setTopicLogs] = useState([]);
+    const [headerFilter, setHeaderFilter] = useState('');
     const [error, setError] = useState(null);
     const [showError, setShowError] = useState(false);
     const [openDialog, setOpenDialog] = useState(false);
@@ -275,7 +281,7 @@ const KafkaDashboard = () => {
                     data.Partitions,
                     data.Replication,
                     data.Messages,
-                    data.Lag,
+                    data.TotalLag,
                     data.Throughput,
                 ]);
             };
@@ -338,7 +344,7 @@ const KafkaDashboard = () => {
             };
             ws.onmessage = (event) => {
                 console.log('WebSocket message:', event.data);
-                setTopicLogs((prevLogs) => [...prevLogs, event.data]);
+                setTopicLogs((prevLogs) => [...prevLogs, parseEnvelope(event.data)]);
                 scrollLogBox();
             };
             ws.onerror = (event) => {
@@ -820,7 +826,7 @@ const KafkaDashboard = () => {
                                                     </Typography>
                                                     <Typography variant="h6" sx={{ color: theme.palette.text.primary }}>
                                                         {topicLogs.length > 0 
-                                                            ? `${Math.round(topicLogs.reduce((acc, msg) => acc + (typeof msg === 'string' ? msg.length : JSON.stringify(msg).length), 0) / topicLogs.length)} bytes` 
+                                                            ? `${Math.round(topicLogs.reduce((acc, msg) => acc + payloadText(msg.value).length, 0) / topicLogs.length)} bytes` 
                                                             : '0 bytes'}
                                                     </Typography>
                                                 </Grid>
@@ -838,11 +844,21 @@ const KafkaDashboard = () => {
                                 </Grid>
                             </Grid>
 
+                            <HistoryChart topic={selectedTopic} />
+
                             {/* Live Messages */}
                             <Box mt={4}>
-                                <Typography variant="h6" gutterBottom sx={{ color: theme.palette.text.primary }}>
-                                    Live Messages
-                                </Typography>
+                                <Box sx={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', mb: 1 }}>
+                                    <Typography variant="h6" sx={{ color: theme.palette.text.primary }}>
+                                        Live Messages
+                                    </Typography>
+                                    <TextField
+                                        size="small"
+                                        label="Header filter (key or key=value)"
+                                        value={headerFilter}
+                                        onChange={(e) => setHeaderFilter(e.target.value)}
+                                    />
+                                </Box>
                                 <Paper
                                     sx={{
                                         height: '350px',
@@ -854,7 +870,7 @@ const KafkaDashboard = () => {
                                     ref={logBoxRef}
                                 >
                                     {topicLogs.length > 0 ? (
-                                        topicLogs.map((log, index) => (
+                                        topicLogs.filter((log) => matchesHeaderFilter(log, headerFilter)).map((log, index) => (
                                             <MessageVisualizer 
                                                 key={index} 
                                                 message={log} 
@@ -0,0 +1,40 @@
+// Helpers for the record envelopes sent by /ws and /topics/{topic}/messages.
+// Keys, values and header values are payloads of the form
+// { data, encoding: 'utf8' | 'base64', contentType }, or null.
+
+export const parseEnvelope = (raw) => {
+    try {
+        const envelope = JSON.parse(raw);
+        if (envelope && typeof envelope === 'object' && 'offset' in envelope) {
+            return envelope;
+        }
+    } catch (e) {
+        // Not an envelope; fall through.
+    }
+    return { value: { data: String(raw), encoding: 'utf8', contentType: 'text/plain' }, headers: [] };
+};
+
+export const payloadText = (payload) => (payload ? payload.data : '');
+
+// payloadValue returns parsed JSON for JSON payloads and the raw text otherwise.
+export const payloadValue = (payload) => {
+    if (!payload) return null;
+    if (payload.contentType === 'application/json') {
+        try {
+            return JSON.parse(payload.data);
+        } catch (e) {
+            return payload.data;
+        }
+    }
+    return payload.data;
+};
+
+// matchesHeaderFilter accepts "key" (header present) or "key=value".
+export const matchesHeaderFilter = (envelope, filter) => {
+    if (!filter) return true;
+    const [key, ...rest] = filter.split('=');
+    const value = rest.join('=');
+    return (envelope.headers || []).some((header) =>
+        header.key === key.trim() && (rest.length === 0 || payloadText(header.value) === value.trim())
+    );
+};
@@ -1,18 +1,22 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/IBM/sarama"
 	"github.com/gorilla/websocket"
-	"github.com/samuel/go-zookeeper/zk"
 	"github.com/umerfarok/kafka-live-dashboard/config"
 )
 
@@ -25,95 +29,243 @@ var upgrader = websocket.Upgrader{
 }
 
 type TopicStatus struct {
-	Name        string
-	Partitions  int
-	Replication int
-	Active      bool
-	Messages    int64
-	Lag         int64
-	Throughput  float64
+	Name string
+	TopicMetrics
 }
 
+// TopicMetrics is the payload of /topics/{name} and /ws/topics/{name}.
+// Throughput is the one-minute produce rate in messages per second, and
+// Active means a message was produced within the configured active window.
+// Lag is broken down by consumer group; TotalLag is its sum. LagSeconds is
+// each group's worst estimated time lag, only filled in for single-topic
+// requests since it may read records from the cluster.
+type TopicMetrics struct {
+	Partitions     int
+	Replication    int
+	Active         bool
+	Messages       int64
+	Lag            map[string]int64
+	TotalLag       int64
+	LagSeconds     map[string]float64 `json:",omitempty"`
+	Throughput     float64
+	Rates          ThroughputRates
+	PartitionRates map[int32]ThroughputRates
+	LastProduced   time.Time
+}
+
+// ClusterStatus is an immutable snapshot published by the metadata
+// refresher; never modify one after it has been stored.
 type ClusterStatus struct {
 	Topics       []TopicStatus
 	TotalTopics  int
 	ActiveTopics int
 	Partitions   int
 	Brokers      []BrokerInfo
+	// Health counts partitions with replication problems; the full report
+	// is served by /partitions/health. It is null when the partitions
+	// couldn't be described.
+	Health *PartitionHealthCounts `json:"health"`
+	health *PartitionHealth
+
+	LastUpdated time.Time `json:"lastUpdated"`
+	// RefreshDuration is how long building the snapshot took, in milliseconds.
+	RefreshDuration int64  `json:"refreshDuration"`
+	Stale           bool   `json:"stale"`
+	LastError       string `json:"lastError,omitempty"`
 }
 
 type BrokerInfo struct {
 	ID       int32
 	Hostname string
 	Port     int32
+	Rack     string `json:",omitempty"`
 }
 
 type TopicConfig struct {
-	Name        string `json:"name"`
-	Partitions  int    `json:"partitions"`
-	Replication int    `json:"replication"`
+	Name        string             `json:"name"`
+	Partitions  int                `json:"partitions"`
+	Replication int                `json:"replication"`
+	Configs     map[string]*string `json:"configs"`
 }
 
 type Server struct {
 	config        *config.Config
 	kafkaConn     sarama.Client
-	zkConn        *zk.Conn
-	clusterStatus *ClusterStatus
-	mu            sync.RWMutex
-	topics        []string
+	source        ClusterMetadataSource
+	sampler       *OffsetSampler
+	timestamps    *timestampCache
+	history       *HistoryStore
+	decoders      *DecoderChain
+	producerMu    sync.Mutex
+	syncProducer  sarama.SyncProducer
+	jobs          *JobManager
+	exports       exportFiles
+	resetPlans    offsetResetPlans
+	minISR        minISRCache
+	groupStates   *groupStateTracker
+	groupCache    *groupCache
+	rebalances    *rebalanceTracker
+	clusterStatus atomic.Pointer[ClusterStatus]
+	refresh       clusterRefresher
+	done          chan struct{}
 }
 
-func NewServer(config *config.Config) (*Server, error) {
+// newKafkaConfig builds the sarama configuration, including SASL and TLS,
+// shared by every client the server opens against its cluster.
+func newKafkaConfig(config *config.Config) (*sarama.Config, error) {
 	kafkaConfig := sarama.NewConfig()
 	kafkaConfig.Version = sarama.V2_6_0_0
+	kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll
+	kafkaConfig.Producer.Retry.Max = 5
+	kafkaConfig.Producer.Return.Successes = true
+	kafkaConfig.Producer.Partitioner = newRecordPartitioner
 
 	if config.UseSASL {
+		mechanism := strings.ToUpper(config.SASLMechanism)
+		if mechanism != "" && mechanism != sarama.SASLTypePlaintext {
+			return nil, fmt.Errorf("unsupported SASL mechanism %q", config.SASLMechanism)
+		}
 		kafkaConfig.Net.SASL.Enable = true
 		kafkaConfig.Net.SASL.User = config.KafkaUsername
 		kafkaConfig.Net.SASL.Password = config.KafkaPassword
 		kafkaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
 	}
 
-	kafkaConn, err := sarama.NewClient(strings.Split(config.KafkaBrokers, ","), kafkaConfig)
+	if config.TLSEnabled {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: config.TLSInsecureSkipVerify,
+		}
+
+		if config.TLSCAFile != "" {
+			caCert, err := os.ReadFile(config.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caCert) {
+				return nil, fmt.Errorf("no certificates found in %s", config.TLSCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		kafkaConfig.Net.TLS.Enable = true
+		kafkaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	return kafkaConfig, nil
+}
+
+func NewServer(config *config.Config) (*Server, error) {
+	kafkaConfig, err := newKafkaConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	zkConn, _, err := zk.Connect(strings.Split(config.ZookeeperNodes, ","), time.Second)
+	kafkaConn, err := sarama.NewClient(strings.Split(config.KafkaBrokers, ","), kafkaConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Server{
-		config:    config,
-		kafkaConn: kafkaConn,
-		zkConn:    zkConn,
-	}, nil
+	// ZooKeeper is only needed for legacy clusters; KRaft clusters are
+	// discovered entirely through the Kafka protocol.
+	var source ClusterMetadataSource = NewKafkaMetadataSource(kafkaConn)
+	if config.UseZookeeper() {
+		if config.ZookeeperNodes == "" {
+			kafkaConn.Close()
+			return nil, fmt.Errorf("METADATA_SOURCE is zookeeper but ZOOKEEPER_NODES is empty")
+		}
+		source, err = NewZookeeperMetadataSource(strings.Split(config.ZookeeperNodes, ","), kafkaConn)
+		if err != nil {
+			kafkaConn.Close()
+			return nil, err
+		}
+	}
+
+	return NewServerWithSource(config, kafkaConn, source), nil
+}
+
+// NewServerWithSource builds a Server around an existing metadata source.
+// kafkaConn may be nil, in which case only metadata-backed endpoints work.
+func NewServerWithSource(config *config.Config, kafkaConn sarama.Client, source ClusterMetadataSource) *Server {
+	sampleInterval := time.Duration(config.OffsetSampleInterval) * time.Second
+	activeWindow := time.Duration(config.ActiveWindow) * time.Second
+
+	historyDir := ""
+	if config.HistoryDir != "" {
+		historyDir = filepath.Join(config.HistoryDir, config.ClusterID)
+	}
+	history, err := NewHistoryStore(historyDir, config.HistoryResolution(), config.HistoryRetention())
+	if err != nil {
+		log.Printf("Failed to open history store in %s, keeping history in memory: %v", historyDir, err)
+		history, _ = NewHistoryStore("", config.HistoryResolution(), config.HistoryRetention())
+	}
+
+	s := &Server{
+		config:      config,
+		kafkaConn:   kafkaConn,
+		source:      source,
+		sampler:     NewOffsetSampler(source, sampleInterval, activeWindow),
+		timestamps:  newTimestampCache(),
+		history:     history,
+		decoders:    newDecoderChain(config),
+		jobs:        NewJobManager(),
+		groupStates: newGroupStateTracker(),
+		rebalances:  newRebalanceTracker(),
+		done:        make(chan struct{}),
+	}
+	if kafkaConn != nil {
+		s.groupCache = newGroupCache(kafkaConn, s.newClusterAdmin,
+			time.Duration(config.GroupCacheTTL)*time.Second, config.GroupWorkers,
+			func(description *sarama.GroupDescription, now time.Time) {
+				s.groupStates.observe(description.GroupId, description.State, now)
+				s.rebalances.observe(description, now)
+			})
+	}
+	return s
+}
+
+// Run starts the server's background loops and blocks until it is closed.
+func (s *Server) Run() {
+	go s.sampler.Run(s.done)
+	go s.recordHistory(s.config.HistoryResolution())
+	go s.history.Run(s.done, time.Minute)
+	if s.kafkaConn != nil {
+		go s.trackGroupStates(time.Duration(s.config.GroupPollInterval) * time.Second)
+	}
+	s.refreshClusterStatus()
+}
+
+// Close stops background watchers and releases cluster connections.
+func (s *Server) Close() error {
+	close(s.done)
+	s.jobs.CancelAll()
+	s.source.Close()
+	s.producerMu.Lock()
+	if s.syncProducer != nil {
+		s.syncProducer.Close()
+	}
+	s.producerMu.Unlock()
+	if s.kafkaConn != nil {
+		return s.kafkaConn.Close()
+	}
+	return nil
 }
 
 func (s *Server) serveTopicMetrics(w http.ResponseWriter, r *http.Request, topicName string) {
-	partitions, replication, active, messages, lag, throughput, err := s.getTopicMetrics(topicName)
+	topicMetrics, err := s.getTopicMetrics(topicName, timeLagRecords)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get metrics for topic %s: %v", topicName, err), http.StatusInternalServerError)
 		return
 	}
 
-	topicMetrics := struct {
-		Partitions  int
-		Replication int
-		Active      bool
-		Messages    int64
-		Lag         int64
-		Throughput  float64
-	}{
-		Partitions:  partitions,
-		Replication: replication,
-		Active:      active,
-		Messages:    messages,
-		Lag:         lag,
-		Throughput:  throughput,
-	}
-
 	jsonBytes, err := json.Marshal(topicMetrics)
 	if err != nil {
 		http.Error(w, "Failed to marshal topic metrics", http.StatusInternalServerError)
@@ -132,28 +284,13 @@ func (s *Server) serveTopicMetricsWebSocket(w http.ResponseWriter, r *http.Reque
 	defer conn.Close()
 
 	for {
-		partitions, replication, active, messages, lag, throughput, err := s.getTopicMetrics(topic)
+		topicMetrics, err := s.getTopicMetrics(topic, timeLagInterpolated)
 		if err != nil {
 			log.Println(err)
+			time.Sleep(1 * time.Second)
 			continue
 		}
 
-		topicMetrics := struct {
-			Partitions  int
-			Replication int
-			Active      bool
-			Messages    int64
-			Lag         int64
-			Throughput  float64
-		}{
-			Partitions:  partitions,
-			Replication: replication,
-			Active:      active,
-			Messages:    messages,
-			Lag:         lag,
-			Throughput:  throughput,
-		}
-
 		err = conn.WriteJSON(topicMetrics)
 		if err != nil {
 			log.Println(err)
@@ -166,7 +303,7 @@ func (s *Server) serveTopicMetricsWebSocket(w http.ResponseWriter, r *http.Reque
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 
 	if r.Method == "OPTIONS" {
@@ -181,11 +318,52 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.serveTopicList(w, r)
 	case r.URL.Path == "/topics" && r.Method == "POST":
 		s.createTopic(w, r)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/messages") && r.Method == "GET":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/messages")
+		s.serveTopicMessages(w, r, topicName)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/messages") && r.Method == "POST":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/messages")
+		s.produceMessages(w, r, topicName)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/export") && r.Method == "POST":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/export")
+		s.startExport(w, r, topicName)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/replay") && r.Method == "POST":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/replay")
+		s.startReplay(w, r, topicName)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/config") && r.Method == "GET":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/config")
+		s.serveTopicConfig(w, r, topicName)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/config") && r.Method == "PATCH":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/config")
+		s.alterTopicConfig(w, r, topicName)
+	case strings.HasPrefix(r.URL.Path, "/topics/") && strings.HasSuffix(r.URL.Path, "/partitions") && r.Method == "POST":
+		topicName := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/topics/"), "/partitions")
+		s.increasePartitions(w, r, topicName)
 	case strings.HasPrefix(r.URL.Path, "/topics/") && r.Method == "DELETE":
 		s.deleteTopic(w, r)
 	case strings.HasPrefix(r.URL.Path, "/topics/"):
 		topicName := strings.TrimPrefix(r.URL.Path, "/topics/")
 		s.serveTopicMetrics(w, r, topicName)
+	case r.URL.Path == "/consumer-groups/delete" && r.Method == "POST":
+		s.deleteConsumerGroups(w, r)
+	case strings.HasPrefix(r.URL.Path, "/consumer-groups/") && strings.HasSuffix(r.URL.Path, "/offsets") && r.Method == "DELETE":
+		group := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/consumer-groups/"), "/offsets")
+		s.deleteGroupOffsets(w, r, group)
+	case strings.HasPrefix(r.URL.Path, "/consumer-groups/") && r.Method == "DELETE":
+		group := strings.TrimPrefix(r.URL.Path, "/consumer-groups/")
+		s.deleteConsumerGroup(w, r, group)
+	case strings.HasPrefix(r.URL.Path, "/consumer-groups/") && strings.HasSuffix(r.URL.Path, "/offsets/reset") && r.Method == "POST":
+		group := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/consumer-groups/"), "/offsets/reset")
+		s.resetGroupOffsets(w, r, group)
+	case strings.HasPrefix(r.URL.Path, "/consumer-groups/") && strings.HasSuffix(r.URL.Path, "/lag"):
+		group := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/consumer-groups/"), "/lag")
+		s.serveConsumerGroupLag(w, r, group)
+	case strings.HasPrefix(r.URL.Path, "/consumer-groups/") && strings.HasSuffix(r.URL.Path, "/rebalances"):
+		group := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/consumer-groups/"), "/rebalances")
+		s.serveGroupRebalances(w, r, group)
+	case strings.HasPrefix(r.URL.Path, "/consumer-groups/") && r.Method == "GET":
+		group := strings.TrimPrefix(r.URL.Path, "/consumer-groups/")
+		s.serveConsumerGroup(w, r, group)
 	case r.URL.Path == "/consumer-groups":
 		s.serveConsumerGroups(w, r)
 	case strings.HasPrefix(r.URL.Path, "/ws/topics/"):
@@ -193,6 +371,33 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.serveTopicMetricsWebSocket(w, r, topicName)
 	case r.URL.Path == "/ws":
 		s.serveWebSocket(w, r)
+	case r.URL.Path == "/reassignments/plan" && r.Method == "POST":
+		s.serveReassignmentPlan(w, r)
+	case r.URL.Path == "/reassignments" && r.Method == "POST":
+		s.startReassignment(w, r)
+	case r.URL.Path == "/reassignments":
+		s.serveReassignments(w, r)
+	case r.URL.Path == "/ws/rebalances":
+		s.serveRebalanceWebSocket(w, r)
+	case r.URL.Path == "/ws/partitions/health":
+		s.servePartitionHealthWebSocket(w, r)
+	case r.URL.Path == "/partitions/health":
+		s.servePartitionHealth(w, r)
+	case r.URL.Path == "/leaders" && r.Method == "GET":
+		s.serveLeaderReport(w, r)
+	case r.URL.Path == "/leaders/elect" && r.Method == "POST":
+		s.electLeaders(w, r)
+	case r.URL.Path == "/jobs":
+		s.serveJobs(w, r)
+	case strings.HasPrefix(r.URL.Path, "/jobs/") && strings.HasSuffix(r.URL.Path, "/download"):
+		jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/download")
+		s.serveExportDownload(w, r, jobID)
+	case strings.HasPrefix(r.URL.Path, "/jobs/") && r.Method == "DELETE":
+		s.cancelJob(w, r, strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	case strings.HasPrefix(r.URL.Path, "/jobs/"):
+		s.serveJob(w, r, strings.TrimPrefix(r.URL.Path, "/jobs/"))
+	case r.URL.Path == "/history":
+		s.serveHistory(w, r)
 	case r.URL.Path == "/kafka_metrics":
 		s.ServeKafkaMetrics(w, r)
 	default:
@@ -207,7 +412,7 @@ func (s *Server) createTopic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	admin, err := sarama.NewClusterAdmin(strings.Split(s.config.KafkaBrokers, ","), s.kafkaConn.Config())
+	admin, err := s.newClusterAdmin()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
 		return
@@ -217,6 +422,7 @@ func (s *Server) createTopic(w http.ResponseWriter, r *http.Request) {
 	err = admin.CreateTopic(config.Name, &sarama.TopicDetail{
 		NumPartitions:     int32(config.Partitions),
 		ReplicationFactor: int16(config.Replication),
+		ConfigEntries:     config.Configs,
 	}, false)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create topic: %v", err), http.StatusInternalServerError)
@@ -229,7 +435,7 @@ func (s *Server) createTopic(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteTopic(w http.ResponseWriter, r *http.Request) {
 	topicName := strings.TrimPrefix(r.URL.Path, "/topics/")
 
-	admin, err := sarama.NewClusterAdmin(strings.Split(s.config.KafkaBrokers, ","), s.kafkaConn.Config())
+	admin, err := s.newClusterAdmin()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
 		return
@@ -245,54 +451,8 @@ func (s *Server) deleteTopic(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) serveConsumerGroups(w http.ResponseWriter, r *http.Request) {
-	admin, err := sarama.NewClusterAdmin(strings.Split(s.config.KafkaBrokers, ","), s.kafkaConn.Config())
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer admin.Close()
-
-	groups, err := admin.ListConsumerGroups()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to list consumer groups: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	groupDetails := make(map[string]interface{})
-	for group := range groups {
-		description, err := admin.DescribeConsumerGroups([]string{group})
-		if err != nil {
-			continue
-		}
-
-		members := make(map[string]interface{})
-		for _, member := range description[0].Members {
-			metadata, err := member.GetMemberMetadata()
-			if err != nil {
-				continue
-			}
-
-			members[member.ClientId] = map[string]interface{}{
-				"topics":     metadata.Topics,
-				"userdata":   string(metadata.UserData),
-				"clientHost": member.ClientHost,
-			}
-		}
-
-		groupDetails[group] = map[string]interface{}{
-			"state":   description[0].State,
-			"members": members,
-		}
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(groupDetails)
-}
-
 func (s *Server) serveClusterStatus(w http.ResponseWriter, r *http.Request) {
-	s.updateClusterStatus()
-	jsonBytes, err := json.Marshal(s.clusterStatus)
+	jsonBytes, err := json.Marshal(s.currentClusterStatus())
 	if err != nil {
 		http.Error(w, "Failed to marshal cluster status", http.StatusInternalServerError)
 		return
@@ -302,8 +462,7 @@ func (s *Server) serveClusterStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) serveTopicList(w http.ResponseWriter, r *http.Request) {
-	s.updateClusterStatus()
-	jsonBytes, err := json.Marshal(s.clusterStatus.Topics)
+	jsonBytes, err := json.Marshal(s.currentClusterStatus().Topics)
 	if err != nil {
 		http.Error(w, "Failed to marshal topic list", http.StatusInternalServerError)
 		return
@@ -313,45 +472,64 @@ func (s *Server) serveTopicList(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
-		return
-	}
-	defer conn.Close()
-
-	topic := r.URL.Query().Get("topic")
+	query := r.URL.Query()
+	topic := query.Get("topic")
 	if topic == "" {
 		http.Error(w, "Topic not specified", http.StatusBadRequest)
 		return
 	}
 
-	s.handleWebSocket(conn, topic)
-}
+	if query.Get("mode") == "browse" {
+		req, err := parseBrowseRequest(topic, query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-func (s *Server) updateClusterStatus() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("WebSocket upgrade error:", err)
+			return
+		}
+		defer conn.Close()
 
-	if s.clusterStatus == nil {
-		s.clusterStatus = &ClusterStatus{}
-		s.fetchClusterMetadata()
+		s.handleBrowseWebSocket(conn, req)
+		return
 	}
-}
-func (s *Server) fetchClusterMetadata() {
-	topics, err := s.getTopics()
+
+	var filter *MessageFilter
+	if raw := query.Get("filter"); raw != "" {
+		var err error
+		filter, err = CompileFilter(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Failed to get topics:", err)
+		log.Println("WebSocket upgrade error:", err)
 		return
 	}
+	defer conn.Close()
+
+	s.handleWebSocket(conn, topic, filter)
+}
 
-	brokers, err := s.getBrokers()
+func (s *Server) fetchClusterMetadata() (*ClusterStatus, error) {
+	topics, err := s.source.ListTopics()
 	if err != nil {
-		log.Println("Failed to get brokers:", err)
-		return
+		return nil, fmt.Errorf("failed to get topics: %w", err)
+	}
+
+	brokers, err := s.source.ListBrokers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brokers: %w", err)
 	}
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	topicStatus := make([]TopicStatus, len(topics))
 	totalPartitions := 0
 	activeTopics := 0
@@ -360,291 +538,151 @@ func (s *Server) fetchClusterMetadata() {
 		wg.Add(1)
 		go func(i int, topic string) {
 			defer wg.Done()
-			partitions, replication, active, messages, lag, throughput, err := s.getTopicMetrics(topic)
+			topicMetrics, err := s.getTopicMetrics(topic, timeLagNone)
 			if err != nil {
 				log.Printf("Failed to get metrics for topic %s: %v", topic, err)
 				return
 			}
 			topicStatus[i] = TopicStatus{
-				Name:        topic,
-				Partitions:  partitions,
-				Replication: replication,
-				Active:      active,
-				Messages:    messages,
-				Lag:         lag,
-				Throughput:  throughput,
+				Name:         topic,
+				TopicMetrics: topicMetrics,
 			}
-			totalPartitions += partitions
-			if active {
+
+			mu.Lock()
+			totalPartitions += topicMetrics.Partitions
+			if topicMetrics.Active {
 				activeTopics++
 			}
+			mu.Unlock()
 		}(i, topic)
 	}
 
 	wg.Wait()
 
-	s.clusterStatus.Topics = topicStatus
-	s.clusterStatus.TotalTopics = len(topics)
-	s.clusterStatus.ActiveTopics = activeTopics
-	s.clusterStatus.Partitions = totalPartitions
-	s.clusterStatus.Brokers = brokers
-}
-func (s *Server) updateTopics() {
-	for {
-		children, _, events, err := s.zkConn.ChildrenW("/brokers/topics")
-		if err != nil {
-			log.Println(err)
-			time.Sleep(time.Second)
-			continue
-		}
-
-		s.mu.Lock()
-		s.topics = children
-		s.mu.Unlock()
-
-		select {
-		case event := <-events:
-			if event.Type == zk.EventNodeChildrenChanged {
-				log.Println("Topics changed")
-				continue
-			}
-		case <-time.After(time.Second * 10):
-			continue
-		}
+	status := &ClusterStatus{
+		Topics:       topicStatus,
+		TotalTopics:  len(topics),
+		ActiveTopics: activeTopics,
+		Partitions:   totalPartitions,
+		Brokers:      brokers,
 	}
-}
 
-func (s *Server) getTopics() ([]string, error) {
-	children, _, err := s.zkConn.Children("/brokers/topics")
+	metadata, err := s.source.DescribeTopics(topics)
 	if err != nil {
-		return nil, err
+		log.Printf("Failed to describe topics for partition health: %v", err)
+		return status, nil
 	}
-	return children, nil
+	status.health = partitionHealth(metadata, brokers, s.minISR.get(s, topics))
+	status.health.LastUpdated = time.Now()
+	status.Health = &status.health.PartitionHealthCounts
+	return status, nil
 }
 
-func (s *Server) getBrokers() ([]BrokerInfo, error) {
-	brokerIDs, _, err := s.zkConn.Children("/brokers/ids")
+func (s *Server) getTopicMetrics(topic string, timeLag timeLagMode) (TopicMetrics, error) {
+	metadata, err := s.source.DescribeTopics([]string{topic})
 	if err != nil {
-		return nil, err
+		return TopicMetrics{}, err
 	}
-
-	var wg sync.WaitGroup
-	brokers := make([]BrokerInfo, len(brokerIDs))
-	errs := make(chan error, len(brokerIDs))
-
-	for i, brokerID := range brokerIDs {
-		wg.Add(1)
-		go func(i int, brokerID string) {
-			defer wg.Done()
-
-			data, _, err := s.zkConn.Get(fmt.Sprintf("/brokers/ids/%s", brokerID))
-			if err != nil {
-				errs <- err
-				return
-			}
-
-			var broker struct {
-				Timestamp string   `json:"timestamp"`
-				Endpoints []string `json:"endpoints"`
-				Host      string   `json:"host"`
-				Port      int32    `json:"port"`
-				Version   int32    `json:"version"`
-			}
-			if err := json.Unmarshal(data, &broker); err != nil {
-				errs <- err
-				return
-			}
-
-			brokers[i] = BrokerInfo{
-				ID:       int32(mustAtoi(brokerID)),
-				Hostname: broker.Host,
-				Port:     broker.Port,
-			}
-		}(i, brokerID)
+	if len(metadata) == 0 {
+		return TopicMetrics{}, fmt.Errorf("topic %s not found", topic)
 	}
 
-	wg.Wait()
-
-	select {
-	case err := <-errs:
-		return nil, err
-	default:
-	}
-
-	return brokers, nil
-}
-
-func (s *Server) getTopicMetrics(topic string) (int, int, bool, int64, int64, float64, error) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	var partitions int
-	var replication int
-	var activityErr, partitionsErr, replicationErr error
-
-	go func() {
-		defer wg.Done()
-		partitions, partitionsErr = s.getPartitionCount(topic)
-	}()
-
-	go func() {
-		defer wg.Done()
-		replication, replicationErr = s.getReplicationFactor(topic)
-	}()
-
-	var activityActive bool
-	var activityMessages int64
-	var activityLag int64
-	var activityThroughput float64
-
-	go func() {
-		defer wg.Done()
-		activityActive, activityMessages, activityLag, activityThroughput, activityErr = s.getTopicActivityMetrics(topic)
-	}()
-
-	wg.Wait()
-
-	if partitionsErr != nil {
-		return 0, 0, false, 0, 0, 0, partitionsErr
-	}
-	if replicationErr != nil {
-		return 0, 0, false, 0, 0, 0, replicationErr
-	}
-	if activityErr != nil {
-		return 0, 0, false, 0, 0, 0, activityErr
-	}
-
-	// Get all partitions for the topic
-	allPartitions, err := s.kafkaConn.Partitions(topic)
+	offsets, err := s.source.PartitionOffsets(topic)
 	if err != nil {
-		return 0, 0, false, 0, 0, 0, err
+		return TopicMetrics{}, err
 	}
 
-	// Add consumer group lag calculation
-	admin, err := sarama.NewClusterAdmin(strings.Split(s.config.KafkaBrokers, ","), s.kafkaConn.Config())
-	if err != nil {
-		return 0, 0, false, 0, 0, 0, err
+	var messages int64
+	for _, offset := range offsets {
+		messages += offset.Newest - offset.Oldest
 	}
-	defer admin.Close()
 
-	groups, err := admin.ListConsumerGroups()
+	committed, err := s.getCommittedOffsets(topic, offsets)
 	if err != nil {
-		return 0, 0, false, 0, 0, 0, err
+		return TopicMetrics{}, err
 	}
 
+	groupLag := make(map[string]int64, len(committed))
 	var totalLag int64
-	for group := range groups {
-		offsetFetch, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{
-			topic: allPartitions,
-		})
-		if err != nil {
-			continue
+	// Groups at the same committed offset share one estimate.
+	queries := make(map[timeLagQuery]int)
+	var queryList []timeLagQuery
+	for group, partitions := range committed {
+		for partition, offset := range partitions {
+			lag := offsetLag(offsets[partition].Newest, offset)
+			groupLag[group] += lag
+			totalLag += lag
+
+			query := timeLagQuery{topic, partition, offset, offsets[partition].Newest}
+			if _, ok := queries[query]; !ok {
+				queries[query] = len(queryList)
+				queryList = append(queryList, query)
+			}
 		}
+	}
 
-		for partition, offset := range offsetFetch.Blocks[topic] {
-			if offset.Offset != -1 {
-				newestOffset, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetNewest)
-				if err != nil {
-					continue
+	var lagSeconds map[string]float64
+	if timeLag != timeLagNone {
+		estimates := s.estimateTimeLags(queryList, timeLag == timeLagRecords)
+		lagSeconds = make(map[string]float64, len(committed))
+		for group, partitions := range committed {
+			lagSeconds[group] = 0
+			for partition, offset := range partitions {
+				estimate := estimates[queries[timeLagQuery{topic, partition, offset, offsets[partition].Newest}]]
+				if estimate.seconds > lagSeconds[group] {
+					lagSeconds[group] = estimate.seconds
 				}
-				totalLag += newestOffset - offset.Offset
 			}
 		}
 	}
 
-	// Combine activity metrics with consumer group lag
-	totalLag += activityLag
-
-	return partitions, replication, activityActive, activityMessages, totalLag, activityThroughput, nil
-}
-
-func (s *Server) getPartitionCount(topic string) (int, error) {
-	partitions, _, err := s.zkConn.Children(fmt.Sprintf("/brokers/topics/%s/partitions", topic))
-	if err != nil {
-		return 0, err
-	}
-	return len(partitions), nil
+	throughput := s.sampler.Throughput(topic)
+
+	return TopicMetrics{
+		Partitions:     len(metadata[0].Partitions),
+		Replication:    metadata[0].ReplicationFactor(),
+		Active:         throughput.Active,
+		Messages:       messages,
+		Lag:            groupLag,
+		TotalLag:       totalLag,
+		LagSeconds:     lagSeconds,
+		Throughput:     throughput.Rates.OneMinute,
+		Rates:          throughput.Rates,
+		PartitionRates: throughput.PartitionRates,
+		LastProduced:   throughput.LastProduced,
+	}, nil
 }
 
-func (s *Server) getReplicationFactor(topic string) (int, error) {
-	data, _, err := s.zkConn.Get(fmt.Sprintf("/brokers/topics/%s", topic))
-	if err != nil {
-		return 0, err
-	}
-
-	var topicInfo struct {
-		Partitions map[string][]int32 `json:"partitions"`
-	}
-	if err := json.Unmarshal(data, &topicInfo); err != nil {
-		return 0, err
-	}
-
-	// Assume all partitions have the same replication factor
-	if len(topicInfo.Partitions) > 0 {
-		return len(topicInfo.Partitions["0"]), nil
-	}
-	return 0, nil
-}
-func (s *Server) getTopicActivityMetrics(topic string) (bool, int64, int64, float64, error) {
-	consumer, err := sarama.NewConsumerFromClient(s.kafkaConn)
-	if err != nil {
-		return false, 0, 0, 0, err
+// getCommittedOffsets returns, for every consumer group with committed
+// offsets on topic, the committed offset per partition. Servers without a
+// Kafka client (such as ones backed by FakeMetadataSource) have no groups.
+func (s *Server) getCommittedOffsets(topic string, offsets map[int32]PartitionOffsets) (map[string]map[int32]int64, error) {
+	committed := make(map[string]map[int32]int64)
+	if s.groupCache == nil {
+		return committed, nil
 	}
-	defer consumer.Close()
 
-	partitions, err := consumer.Partitions(topic)
+	groups, err := s.groupCache.committedOffsets()
 	if err != nil {
-		return false, 0, 0, 0, err
-	}
-
-	var totalMessages int64
-	var totalLag int64
-	var active bool
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-
-	// Get the initial newest offsets
-	initialNewestOffsets := make(map[int32]int64)
-	for _, partition := range partitions {
-		newestOffset, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetNewest)
-		if err != nil {
-			return false, 0, 0, 0, err
-		}
-		initialNewestOffsets[partition] = newestOffset
+		return nil, err
 	}
 
-	for _, partition := range partitions {
-		wg.Add(1)
-		go func(partition int32) {
-			defer wg.Done()
-
-			oldestOffset, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetOldest)
-			if err != nil {
-				return
-			}
-
-			newestOffset, err := s.kafkaConn.GetOffset(topic, partition, sarama.OffsetNewest)
-			if err != nil {
-				return
+	for group, topics := range groups {
+		for partition, offset := range topics[topic] {
+			if _, ok := offsets[partition]; !ok {
+				continue
 			}
-
-			mu.Lock()
-			totalLag += newestOffset - oldestOffset
-			totalMessages += newestOffset - oldestOffset
-			if newestOffset > initialNewestOffsets[partition] {
-				active = true
+			if committed[group] == nil {
+				committed[group] = make(map[int32]int64)
 			}
-			mu.Unlock()
-
-		}(partition)
+			committed[group][partition] = offset
+		}
 	}
 
-	wg.Wait()
-
-	return active, totalMessages, totalLag, float64(totalMessages), nil
+	return committed, nil
 }
 
-func (s *Server) handleWebSocket(conn *websocket.Conn, topic string) {
+func (s *Server) handleWebSocket(conn *websocket.Conn, topic string, filter *MessageFilter) {
 	consumer, err := sarama.NewConsumerFromClient(s.kafkaConn)
 	if err != nil {
 		log.Println("Failed to create consumer:", err)
@@ -692,7 +730,10 @@ func (s *Server) handleWebSocket(conn *websocket.Conn, topic string) {
 	for {
 		select {
 		case msg := <-messages:
-			err := conn.WriteMessage(websocket.TextMessage, msg.Value)
+			if !s.matchMessage(filter, msg) {
+				continue
+			}
+			err := conn.WriteJSON(s.newMessageRecord(msg))
 			if err != nil {
 				log.Println("WebSocket write error:", err)
 				return
@@ -714,24 +755,24 @@ func mustAtoi(s string) int {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExportCommand(os.Args[2:]); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		return
+	}
+
 	config, err := config.NewConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	server, err := NewServer(config)
-	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
-	}
+	registry := NewClusterRegistry(config)
+	registry.Start()
 
-	go server.updateTopics()
-	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
-	}
 	CreateTestTopicIfRequired(config)
 
-	http.Handle("/", server)
-	http.HandleFunc("/kafka_metrics", corsMiddleware(server.ServeKafkaMetrics))
+	http.HandleFunc("/", corsMiddleware(registry.ServeHTTP))
 
 	log.Printf("Starting server on :%s\n", config.HTTPPort)
 	if err := http.ListenAndServe(":"+config.HTTPPort, nil); err != nil {
@@ -742,7 +783,7 @@ func main() {
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 
 		if r.Method == "OPTIONS" {
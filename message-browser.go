@@ -0,0 +1,601 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/IBM/sarama"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultBrowseLimit = 50
+	maxBrowseLimit     = 500
+	// browseIdleTimeout bounds how long a partition read waits for the next
+	// record. Control records and compaction can leave gaps that never
+	// produce a message, so an idle partition ends the read instead of
+	// failing it.
+	browseIdleTimeout = 2 * time.Second
+	// browseFilterScan is how many records per partition a filtered page
+	// reads while looking for matches.
+	browseFilterScan = 5000
+)
+
+// Payload is a record key, value or header value. Valid UTF-8 is sent as
+// is; anything else is base64 encoded. ContentType is a best-effort guess
+// at what the bytes hold.
+type Payload struct {
+	Data        string `json:"data"`
+	Encoding    string `json:"encoding"`
+	ContentType string `json:"contentType"`
+	// Format and SchemaID are set when the payload was decoded from a
+	// schema-encoded format; Data then holds its JSON rendering.
+	Format      string `json:"format,omitempty"`
+	SchemaID    int    `json:"schemaId,omitempty"`
+	DecodeError string `json:"decodeError,omitempty"`
+}
+
+type MessageHeader struct {
+	Key   string   `json:"key"`
+	Value *Payload `json:"value"`
+}
+
+// MessageRecord is the envelope of a single record, used by both the
+// message browser and the live stream. A nil Key or Value is a null in
+// Kafka, e.g. a tombstone.
+type MessageRecord struct {
+	Topic     string          `json:"topic"`
+	Partition int32           `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Timestamp time.Time       `json:"timestamp"`
+	Key       *Payload        `json:"key"`
+	Value     *Payload        `json:"value"`
+	Headers   []MessageHeader `json:"headers"`
+}
+
+// MessagePage is a bounded page of records. NextCursor continues after the
+// last record of the page and PrevCursor ends before its first record;
+// PrevCursor is empty when the page starts at the oldest retained offsets.
+type MessagePage struct {
+	Topic      string          `json:"topic"`
+	Records    []MessageRecord `json:"records"`
+	NextCursor string          `json:"nextCursor"`
+	PrevCursor string          `json:"prevCursor,omitempty"`
+}
+
+// BrowseRequest says where a page starts. Exactly one of Offset, Timestamp,
+// FromEnd or Cursor is used; with none of them the page holds the newest
+// Limit records.
+type BrowseRequest struct {
+	Topic      string
+	Partitions []int32
+	Offset     *int64
+	Timestamp  *time.Time
+	FromEnd    int64
+	Cursor     *browseCursor
+	Limit      int
+	Filter     *MessageFilter
+}
+
+// browseCursor holds one position per partition. A forward cursor reads
+// from its offsets; a backward cursor reads the records just before them.
+type browseCursor struct {
+	Backward bool            `json:"b,omitempty"`
+	Offsets  map[int32]int64 `json:"o"`
+}
+
+func (c *browseCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeBrowseCursor(raw string) (*browseCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor browseCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Offsets) == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// partitionRange is the span of one partition read for a page.
+type partitionRange struct {
+	partition int32
+	oldest    int64
+	newest    int64
+	start     int64
+	end       int64
+}
+
+// parseBrowseRequest reads the page position from query parameters:
+// partitions=0,2, offset=N, fromEnd=N, timestamp=(RFC 3339 or Unix
+// milliseconds), cursor=..., limit=N and filter=(see MessageFilter).
+func parseBrowseRequest(topic string, query url.Values) (*BrowseRequest, error) {
+	req := &BrowseRequest{Topic: topic, Limit: defaultBrowseLimit}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %q", raw)
+		}
+		req.Limit = limit
+	}
+
+	if raw := query.Get("partitions"); raw != "" {
+		partitions, err := parsePartitionList(raw)
+		if err != nil {
+			return nil, err
+		}
+		req.Partitions = partitions
+	}
+
+	positions := 0
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset %q", raw)
+		}
+		req.Offset = &offset
+		positions++
+	}
+	if raw := query.Get("fromEnd"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid fromEnd %q", raw)
+		}
+		// fromEnd is the newest N records, so it also bounds the page size.
+		req.FromEnd = n
+		if query.Get("limit") == "" || n < int64(req.Limit) {
+			req.Limit = int(min(n, maxBrowseLimit))
+		}
+		positions++
+	}
+	if raw := query.Get("timestamp"); raw != "" {
+		ts, err := parseMessageTime(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", raw)
+		}
+		req.Timestamp = &ts
+		positions++
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeBrowseCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		req.Cursor = cursor
+		positions++
+	}
+	if raw := query.Get("filter"); raw != "" {
+		filter, err := CompileFilter(raw)
+		if err != nil {
+			return nil, err
+		}
+		req.Filter = filter
+	}
+
+	if positions > 1 {
+		return nil, fmt.Errorf("only one of offset, fromEnd, timestamp or cursor may be given")
+	}
+
+	if req.Limit > maxBrowseLimit {
+		req.Limit = maxBrowseLimit
+	}
+	return req, nil
+}
+
+// parsePartitionList parses a comma separated list of partition numbers.
+func parsePartitionList(raw string) ([]int32, error) {
+	var partitions []int32
+	for _, part := range strings.Split(raw, ",") {
+		partition, err := strconv.ParseInt(strings.TrimSpace(part), 10, 32)
+		if err != nil || partition < 0 {
+			return nil, fmt.Errorf("invalid partition %q", part)
+		}
+		partitions = append(partitions, int32(partition))
+	}
+	return partitions, nil
+}
+
+func parseMessageTime(raw string) (time.Time, error) {
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func (s *Server) serveTopicMessages(w http.ResponseWriter, r *http.Request, topic string) {
+	req, err := parseBrowseRequest(topic, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := s.browseMessages(req)
+	if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		http.Error(w, fmt.Sprintf("Topic %s or partition not found", topic), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read messages: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// handleBrowseWebSocket sends the page described by req and then one page
+// for every {"cursor": "..."} request the client sends. The filter compiled
+// for the first page is reused for the rest of the connection.
+func (s *Server) handleBrowseWebSocket(conn *websocket.Conn, req *BrowseRequest) {
+	filter := req.Filter
+	for {
+		page, err := s.browseMessages(req)
+		if err != nil {
+			err = conn.WriteJSON(map[string]string{"error": err.Error()})
+		} else {
+			err = conn.WriteJSON(page)
+		}
+		if err != nil {
+			log.Println("WebSocket write error:", err)
+			return
+		}
+
+		for {
+			var next struct {
+				Cursor string `json:"cursor"`
+				Limit  int    `json:"limit"`
+			}
+			if err := conn.ReadJSON(&next); err != nil {
+				return
+			}
+
+			query := url.Values{"cursor": {next.Cursor}}
+			if next.Limit > 0 {
+				query.Set("limit", strconv.Itoa(next.Limit))
+			}
+			req, err = parseBrowseRequest(req.Topic, query)
+			if err == nil {
+				break
+			}
+			if err := conn.WriteJSON(map[string]string{"error": err.Error()}); err != nil {
+				log.Println("WebSocket write error:", err)
+				return
+			}
+		}
+		req.Filter = filter
+	}
+}
+
+// browseMessages reads one page of records. Each selected partition is read
+// concurrently over the range its start position implies, the records are
+// merged by timestamp and the page is cut to Limit records, keeping the
+// first records for forward reads and the last for backward ones.
+func (s *Server) browseMessages(req *BrowseRequest) (*MessagePage, error) {
+	if s.kafkaConn == nil {
+		return nil, fmt.Errorf("no Kafka client configured")
+	}
+
+	ranges, backward, err := s.browseRanges(req)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(s.kafkaConn)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	match := func(msg *sarama.ConsumerMessage) bool { return s.matchMessage(req.Filter, msg) }
+
+	var wg sync.WaitGroup
+	results := make([][]*sarama.ConsumerMessage, len(ranges))
+	scanned := make([]int64, len(ranges))
+	errs := make([]error, len(ranges))
+	for i, pr := range ranges {
+		scanned[i] = pr.start
+		if pr.start >= pr.end {
+			continue
+		}
+		want := req.Limit
+		if backward {
+			want = 0
+		}
+		wg.Add(1)
+		go func(i int, pr partitionRange) {
+			defer wg.Done()
+			results[i], scanned[i], errs[i] = readPartitionRange(consumer, req.Topic, pr, match, want)
+		}(i, pr)
+	}
+	wg.Wait()
+
+	var messages []*sarama.ConsumerMessage
+	for i := range ranges {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		messages = append(messages, results[i]...)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		a, b := messages[i], messages[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.Partition != b.Partition {
+			return a.Partition < b.Partition
+		}
+		return a.Offset < b.Offset
+	})
+
+	// dropped holds, per partition, the record nearest the page that was cut
+	// by the limit; the cursor on that side must not skip past it.
+	var dropped []*sarama.ConsumerMessage
+	if len(messages) > req.Limit {
+		if backward {
+			dropped = messages[:len(messages)-req.Limit]
+			messages = messages[len(messages)-req.Limit:]
+		} else {
+			dropped = messages[req.Limit:]
+			messages = messages[:req.Limit]
+		}
+	}
+	nearestDropped := make(map[int32]int64)
+	for _, msg := range dropped {
+		offset, ok := nearestDropped[msg.Partition]
+		if !ok || (backward && msg.Offset > offset) || (!backward && msg.Offset < offset) {
+			nearestDropped[msg.Partition] = msg.Offset
+		}
+	}
+
+	page := &MessagePage{
+		Topic:   req.Topic,
+		Records: make([]MessageRecord, 0, len(messages)),
+	}
+	for _, msg := range messages {
+		page.Records = append(page.Records, s.newMessageRecord(msg))
+	}
+
+	next := &browseCursor{Offsets: make(map[int32]int64)}
+	prev := &browseCursor{Backward: true, Offsets: make(map[int32]int64)}
+	hasPrev := false
+	for i, pr := range ranges {
+		pageStart, pageEnd := pr.start, scanned[i]
+		offset, cut := nearestDropped[pr.partition]
+		if backward {
+			pageEnd = pr.end
+			if cut {
+				pageStart = offset + 1
+			}
+		} else if cut {
+			pageEnd = offset
+		}
+
+		next.Offsets[pr.partition] = pageEnd
+		prev.Offsets[pr.partition] = pageStart
+		if pageStart > pr.oldest {
+			hasPrev = true
+		}
+	}
+
+	page.NextCursor = next.encode()
+	if hasPrev {
+		page.PrevCursor = prev.encode()
+	}
+	return page, nil
+}
+
+// browseRanges resolves the request's start position into a range per
+// partition and reports whether the page is read backward from its end.
+func (s *Server) browseRanges(req *BrowseRequest) ([]partitionRange, bool, error) {
+	partitions := req.Partitions
+	if req.Cursor != nil {
+		partitions = make([]int32, 0, len(req.Cursor.Offsets))
+		for partition := range req.Cursor.Offsets {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	available, err := s.kafkaConn.Partitions(req.Topic)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(partitions) == 0 {
+		partitions = available
+	}
+	known := make(map[int32]bool, len(available))
+	for _, partition := range available {
+		known[partition] = true
+	}
+
+	backward := req.Offset == nil && req.Timestamp == nil && (req.Cursor == nil || req.Cursor.Backward)
+	// Without a filter every record read is on the page, so a partition never
+	// needs more than Limit records. With one, up to browseFilterScan records
+	// are scanned for matches.
+	span := int64(req.Limit)
+	if req.Filter != nil {
+		span = browseFilterScan
+	}
+
+	ranges := make([]partitionRange, 0, len(partitions))
+	for _, partition := range partitions {
+		if !known[partition] {
+			return nil, false, fmt.Errorf("partition %d: %w", partition, sarama.ErrUnknownTopicOrPartition)
+		}
+
+		oldest, err := s.kafkaConn.GetOffset(req.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, false, err
+		}
+		newest, err := s.kafkaConn.GetOffset(req.Topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, false, err
+		}
+
+		pr := partitionRange{partition: partition, oldest: oldest, newest: newest, end: newest}
+		switch {
+		case req.Cursor != nil && req.Cursor.Backward:
+			pr.end = clampOffset(req.Cursor.Offsets[partition], oldest, newest)
+			pr.start = max(oldest, pr.end-span)
+		case req.Cursor != nil:
+			pr.start = clampOffset(req.Cursor.Offsets[partition], oldest, newest)
+		case req.Offset != nil:
+			pr.start = clampOffset(*req.Offset, oldest, newest)
+		case req.Timestamp != nil:
+			offset, err := s.kafkaConn.GetOffset(req.Topic, partition, req.Timestamp.UnixMilli())
+			if err != nil {
+				return nil, false, err
+			}
+			// -1 means no record is at or after the timestamp.
+			if offset < 0 {
+				offset = newest
+			}
+			pr.start = clampOffset(offset, oldest, newest)
+		default:
+			pr.start = max(oldest, newest-span)
+		}
+
+		if !backward {
+			pr.end = min(newest, pr.start+span)
+		}
+		ranges = append(ranges, pr)
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].partition < ranges[j].partition })
+	return ranges, backward, nil
+}
+
+func clampOffset(offset, oldest, newest int64) int64 {
+	return min(max(offset, oldest), newest)
+}
+
+// readPartitionRange returns the records in [pr.start, pr.end) that pass
+// match, stopping early once want records matched (0 reads the whole
+// range). It also returns the offset the read got up to.
+func readPartitionRange(consumer sarama.Consumer, topic string, pr partitionRange, match func(*sarama.ConsumerMessage) bool, want int) ([]*sarama.ConsumerMessage, int64, error) {
+	partitionConsumer, err := consumer.ConsumePartition(topic, pr.partition, pr.start)
+	if err != nil {
+		return nil, pr.start, err
+	}
+	defer partitionConsumer.Close()
+
+	var messages []*sarama.ConsumerMessage
+	idle := time.NewTimer(browseIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case msg := <-partitionConsumer.Messages():
+			if msg.Offset >= pr.end {
+				return messages, pr.end, nil
+			}
+			if match(msg) {
+				messages = append(messages, msg)
+			}
+			if msg.Offset >= pr.end-1 {
+				return messages, pr.end, nil
+			}
+			if want > 0 && len(messages) >= want {
+				return messages, msg.Offset + 1, nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(browseIdleTimeout)
+		case err := <-partitionConsumer.Errors():
+			return nil, pr.start, err
+		case <-idle.C:
+			// Whatever is left of the range isn't deliverable, e.g. a
+			// trailing transaction marker.
+			return messages, pr.end, nil
+		}
+	}
+}
+
+func (s *Server) newMessageRecord(msg *sarama.ConsumerMessage) MessageRecord {
+	record := MessageRecord{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Key:       s.newPayload(msg.Key),
+		Value:     s.newPayload(msg.Value),
+		Headers:   make([]MessageHeader, 0, len(msg.Headers)),
+	}
+	for _, header := range msg.Headers {
+		record.Headers = append(record.Headers, MessageHeader{Key: string(header.Key), Value: newPayload(header.Value)})
+	}
+	return record
+}
+
+// newPayload renders data as JSON when a decoder recognises it and falls
+// back to the raw bytes, with the decode error attached, when it doesn't.
+func (s *Server) newPayload(data []byte) *Payload {
+	decoded, err := s.decoders.Decode(data)
+	if decoded != nil {
+		return &Payload{
+			Data:        string(decoded.JSON),
+			Encoding:    "utf8",
+			ContentType: "application/json",
+			Format:      decoded.Format,
+			SchemaID:    decoded.SchemaID,
+		}
+	}
+
+	payload := newPayload(data)
+	if payload != nil && err != nil {
+		payload.DecodeError = err.Error()
+	}
+	return payload
+}
+
+// matchMessage applies filter to msg with its value decoded, so JSONPath
+// predicates also work on schema-encoded records.
+func (s *Server) matchMessage(filter *MessageFilter, msg *sarama.ConsumerMessage) bool {
+	if filter == nil {
+		return true
+	}
+	value := msg.Value
+	if decoded, _ := s.decoders.Decode(msg.Value); decoded != nil {
+		value = decoded.JSON
+	}
+	return filter.MatchValue(msg, value)
+}
+
+func newPayload(data []byte) *Payload {
+	if data == nil {
+		return nil
+	}
+
+	if utf8.Valid(data) {
+		contentType := "text/plain"
+		if json.Valid(data) {
+			contentType = "application/json"
+		}
+		return &Payload{Data: string(data), Encoding: "utf8", ContentType: contentType}
+	}
+
+	// DetectContentType falls back to application/octet-stream for bytes
+	// it doesn't recognise.
+	return &Payload{
+		Data:        base64.StdEncoding.EncodeToString(data),
+		Encoding:    "base64",
+		ContentType: http.DetectContentType(data),
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/umerfarok/kafka-live-dashboard/config"
+)
+
+// Formats reported for decoded payloads.
+const (
+	FormatAvro       = "avro"
+	FormatProtobuf   = "protobuf"
+	FormatJSONSchema = "jsonschema"
+)
+
+// schemaRetryInterval is how long a schema that failed to load is not
+// asked for again, so a missing schema doesn't cost a registry call per
+// record.
+const schemaRetryInterval = 30 * time.Second
+
+// DecodedData is a payload rendered as JSON by a MessageDecoder.
+type DecodedData struct {
+	JSON     []byte
+	Format   string
+	SchemaID int
+}
+
+// MessageDecoder renders a record key or value as JSON. Decode returns nil
+// data and no error when data isn't in a format the decoder handles, so the
+// next decoder in the chain can try.
+type MessageDecoder interface {
+	Decode(data []byte) (*DecodedData, error)
+}
+
+// DecoderChain tries each decoder in turn. A nil chain decodes nothing.
+type DecoderChain struct {
+	decoders []MessageDecoder
+}
+
+func NewDecoderChain(decoders ...MessageDecoder) *DecoderChain {
+	return &DecoderChain{decoders: decoders}
+}
+
+func (c *DecoderChain) Decode(data []byte) (*DecodedData, error) {
+	if c == nil || data == nil {
+		return nil, nil
+	}
+	for _, decoder := range c.decoders {
+		decoded, err := decoder.Decode(data)
+		if err != nil || decoded != nil {
+			return decoded, err
+		}
+	}
+	return nil, nil
+}
+
+// newDecoderChain builds the decoders configured for a cluster. The local
+// schema directory is consulted before the registry.
+func newDecoderChain(cfg *config.Config) *DecoderChain {
+	var sources []SchemaSource
+	if cfg.SchemaDir != "" {
+		sources = append(sources, NewFileSchemaStore(cfg.SchemaDir))
+	}
+	if cfg.SchemaRegistryURL != "" {
+		sources = append(sources, NewSchemaRegistryClient(cfg.SchemaRegistryURL, cfg.SchemaRegistryUsername, cfg.SchemaRegistryPassword))
+	}
+	if len(sources) == 0 {
+		return NewDecoderChain()
+	}
+	return NewDecoderChain(NewConfluentDecoder(sources...))
+}
+
+// ConfluentDecoder decodes the Confluent wire format: a zero magic byte, a
+// four byte big-endian schema ID and the Avro, Protobuf or JSON Schema
+// encoded payload. Protobuf payloads also carry the index path of the
+// message type within the schema.
+type ConfluentDecoder struct {
+	sources []SchemaSource
+
+	mu       sync.Mutex
+	compiled map[int]*compiledSchema
+	failures map[int]time.Time
+	loading  map[int]*schemaLoad
+}
+
+// schemaLoad is a schema being fetched. Decoders needing the same schema
+// wait for done instead of fetching it again.
+type schemaLoad struct {
+	done   chan struct{}
+	schema *compiledSchema
+	err    error
+}
+
+type compiledSchema struct {
+	schemaType string
+	avro       *goavro.Codec
+	proto      protoreflect.FileDescriptor
+}
+
+func NewConfluentDecoder(sources ...SchemaSource) *ConfluentDecoder {
+	return &ConfluentDecoder{
+		sources:  sources,
+		compiled: make(map[int]*compiledSchema),
+		failures: make(map[int]time.Time),
+		loading:  make(map[int]*schemaLoad),
+	}
+}
+
+func (d *ConfluentDecoder) Decode(data []byte) (*DecodedData, error) {
+	if len(data) < 5 || data[0] != 0 {
+		return nil, nil
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	payload := data[5:]
+
+	schema, err := d.schema(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch schema.schemaType {
+	case SchemaTypeAvro:
+		native, _, err := schema.avro.NativeFromBinary(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Avro with schema %d: %w", id, err)
+		}
+		text, err := schema.avro.TextualFromNative(nil, native)
+		if err != nil {
+			return nil, err
+		}
+		return &DecodedData{JSON: text, Format: FormatAvro, SchemaID: id}, nil
+
+	case SchemaTypeProtobuf:
+		text, err := decodeProtobuf(schema.proto, payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Protobuf with schema %d: %w", id, err)
+		}
+		return &DecodedData{JSON: text, Format: FormatProtobuf, SchemaID: id}, nil
+
+	default:
+		if !json.Valid(payload) {
+			return nil, fmt.Errorf("payload for JSON schema %d is not valid JSON", id)
+		}
+		return &DecodedData{JSON: payload, Format: FormatJSONSchema, SchemaID: id}, nil
+	}
+}
+
+// schema returns the compiled schema for id, loading it from the first
+// source that has it. The lock isn't held while the schema is fetched.
+func (d *ConfluentDecoder) schema(id int) (*compiledSchema, error) {
+	d.mu.Lock()
+	if schema, ok := d.compiled[id]; ok {
+		d.mu.Unlock()
+		return schema, nil
+	}
+	if failed, ok := d.failures[id]; ok && time.Since(failed) < schemaRetryInterval {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("schema %d is unavailable", id)
+	}
+	if load, ok := d.loading[id]; ok {
+		d.mu.Unlock()
+		<-load.done
+		return load.schema, load.err
+	}
+	load := &schemaLoad{done: make(chan struct{})}
+	d.loading[id] = load
+	d.mu.Unlock()
+
+	load.schema, load.err = d.load(id)
+
+	d.mu.Lock()
+	delete(d.loading, id)
+	if load.err != nil {
+		d.failures[id] = time.Now()
+	} else {
+		delete(d.failures, id)
+		d.compiled[id] = load.schema
+	}
+	d.mu.Unlock()
+	close(load.done)
+	return load.schema, load.err
+}
+
+func (d *ConfluentDecoder) load(id int) (*compiledSchema, error) {
+	var raw *Schema
+	var err error
+	for _, source := range d.sources {
+		if raw, err = source.Schema(id); err == nil {
+			break
+		}
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("failed to load schema %d: %w", id, err)
+	}
+
+	compiled := &compiledSchema{schemaType: raw.Type}
+	switch raw.Type {
+	case SchemaTypeAvro:
+		compiled.avro, err = goavro.NewCodec(raw.Text)
+	case SchemaTypeProtobuf:
+		compiled.proto, err = compileProtobuf(id, raw)
+	case SchemaTypeJSON:
+	default:
+		err = fmt.Errorf("unsupported schema type %s", raw.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %d: %w", id, err)
+	}
+	return compiled, nil
+}
+
+func compileProtobuf(id int, schema *Schema) (protoreflect.FileDescriptor, error) {
+	name := fmt.Sprintf("schema-%d.proto", id)
+	sources := map[string]string{name: schema.Text}
+	for ref, text := range schema.References {
+		sources[ref] = text
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	return files[0], nil
+}
+
+// decodeProtobuf reads the message index path that precedes a Confluent
+// Protobuf payload, finds that message type in file and renders the
+// payload as JSON. An index path with no entries means the first message.
+func decodeProtobuf(file protoreflect.FileDescriptor, data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, fmt.Errorf("invalid message index header")
+	}
+	data = data[n:]
+
+	indexes := []int64{0}
+	if count > 0 {
+		indexes = make([]int64, count)
+		for i := range indexes {
+			indexes[i], n = binary.Varint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid message index header")
+			}
+			data = data[n:]
+		}
+	}
+
+	messages := file.Messages()
+	var descriptor protoreflect.MessageDescriptor
+	for _, index := range indexes {
+		if index < 0 || int(index) >= messages.Len() {
+			return nil, fmt.Errorf("message index %d out of range", index)
+		}
+		descriptor = messages.Get(int(index))
+		messages = descriptor.Messages()
+	}
+
+	message := dynamicpb.NewMessage(descriptor)
+	if err := proto.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(message)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const testSchemaDir = "testdata/schemas"
+
+// confluentFrame prefixes payload with the Confluent magic byte and schema
+// ID.
+func confluentFrame(id uint32, payload []byte) []byte {
+	frame := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[1:], id)
+	return append(frame, payload...)
+}
+
+// protobufFrame is confluentFrame with the message index path of a
+// Protobuf payload.
+func protobufFrame(id uint32, indexes []int64, message []byte) []byte {
+	var payload []byte
+	if len(indexes) == 1 && indexes[0] == 0 {
+		payload = binary.AppendVarint(payload, 0)
+	} else {
+		payload = binary.AppendVarint(payload, int64(len(indexes)))
+		for _, index := range indexes {
+			payload = binary.AppendVarint(payload, index)
+		}
+	}
+	return confluentFrame(id, append(payload, message...))
+}
+
+func avroRecord(t *testing.T, native map[string]interface{}) []byte {
+	t.Helper()
+	codec, err := goavro.NewCodec(readFile(t, testSchemaDir+"/1.avsc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := codec.BinaryFromNative(nil, native)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return confluentFrame(1, payload)
+}
+
+func protoItem(sku string, quantity int) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, sku)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(quantity))
+}
+
+func protoOrder() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "o-1")
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, protoItem("A-1", 3))
+}
+
+func protoShipment() []byte {
+	var money []byte
+	money = protowire.AppendTag(money, 1, protowire.BytesType)
+	money = protowire.AppendString(money, "EUR")
+	money = protowire.AppendTag(money, 2, protowire.VarintType)
+	money = protowire.AppendVarint(money, 1250)
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, "o-1")
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, money)
+}
+
+func TestConfluentDecoder(t *testing.T) {
+	decoder := NewConfluentDecoder(NewFileSchemaStore(testSchemaDir))
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		format string
+		id     int
+		want   string
+	}{
+		{
+			name:   "avro",
+			data:   avroRecord(t, map[string]interface{}{"id": "o-1", "quantity": 3, "note": goavro.Union("string", "gift")}),
+			format: FormatAvro, id: 1,
+			want: `{"id": "o-1", "quantity": 3, "note": {"string": "gift"}}`,
+		},
+		{
+			name:   "avro with a null union",
+			data:   avroRecord(t, map[string]interface{}{"id": "o-2", "quantity": 1, "note": nil}),
+			format: FormatAvro, id: 1,
+			want: `{"id": "o-2", "quantity": 1, "note": null}`,
+		},
+		{
+			name:   "protobuf first message",
+			data:   protobufFrame(2, []int64{0}, protoOrder()),
+			format: FormatProtobuf, id: 2,
+			want: `{"id": "o-1", "items": [{"sku": "A-1", "quantity": 3}]}`,
+		},
+		{
+			name:   "protobuf second message with an imported type",
+			data:   protobufFrame(2, []int64{1}, protoShipment()),
+			format: FormatProtobuf, id: 2,
+			want: `{"orderId": "o-1", "cost": {"currency": "EUR", "units": "1250"}}`,
+		},
+		{
+			name:   "protobuf nested message",
+			data:   protobufFrame(2, []int64{0, 0}, protoItem("B-7", 2)),
+			format: FormatProtobuf, id: 2,
+			want: `{"sku": "B-7", "quantity": 2}`,
+		},
+		{
+			name:   "json schema",
+			data:   confluentFrame(3, []byte(`{"id": "o-1", "quantity": 3}`)),
+			format: FormatJSONSchema, id: 3,
+			want: `{"id": "o-1", "quantity": 3}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded, err := decoder.Decode(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded == nil {
+				t.Fatal("record was not decoded")
+			}
+			if decoded.Format != tc.format || decoded.SchemaID != tc.id {
+				t.Errorf("format %s, schema %d; want %s, %d", decoded.Format, decoded.SchemaID, tc.format, tc.id)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(decoded.JSON, &got); err != nil {
+				t.Fatalf("decoded JSON %s: %v", decoded.JSON, err)
+			}
+			json.Unmarshal([]byte(tc.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %s, want %s", decoded.JSON, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfluentDecoderErrors(t *testing.T) {
+	decoder := NewConfluentDecoder(NewFileSchemaStore(testSchemaDir))
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"unknown schema", confluentFrame(99, []byte("{}")), "failed to load schema 99: schema 99 not found in " + testSchemaDir},
+		{"unknown schema again", confluentFrame(99, []byte("{}")), "schema 99 is unavailable"},
+		{"invalid schema", confluentFrame(4, nil), "failed to compile schema 4"},
+		{"truncated avro", confluentFrame(1, []byte{0x02}), "failed to decode Avro with schema 1"},
+		{"protobuf index out of range", protobufFrame(2, []int64{5}, nil), "message index 5 out of range"},
+		{"protobuf without an index header", confluentFrame(2, nil), "invalid message index header"},
+		{"invalid json", confluentFrame(3, []byte("{")), "payload for JSON schema 3 is not valid JSON"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decoded, err := decoder.Decode(tc.data)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %+v, %v; want an error containing %q", decoded, err, tc.want)
+			}
+		})
+	}
+}
+
+// slowSchemaSource counts how often a schema is fetched.
+type slowSchemaSource struct {
+	SchemaSource
+	fetches atomic.Int32
+}
+
+func (s *slowSchemaSource) Schema(id int) (*Schema, error) {
+	s.fetches.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return s.SchemaSource.Schema(id)
+}
+
+func TestConfluentDecoderSharesSchemaLoads(t *testing.T) {
+	source := &slowSchemaSource{SchemaSource: NewFileSchemaStore(testSchemaDir)}
+	decoder := NewConfluentDecoder(source)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := decoder.Decode(confluentFrame(3, []byte("{}"))); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := source.fetches.Load(); n != 1 {
+		t.Errorf("schema fetched %d times, want once", n)
+	}
+}
+
+func TestDecoderChainSkipsUnframedData(t *testing.T) {
+	chain := NewDecoderChain(NewConfluentDecoder(NewFileSchemaStore(testSchemaDir)))
+	for _, data := range [][]byte{nil, []byte(`{"id": 1}`), {0, 0, 0}} {
+		if decoded, err := chain.Decode(data); decoded != nil || err != nil {
+			t.Errorf("Decode(%q) = %+v, %v; want nothing", data, decoded, err)
+		}
+	}
+
+	var nilChain *DecoderChain
+	if decoded, err := nilChain.Decode(confluentFrame(3, []byte("{}"))); decoded != nil || err != nil {
+		t.Errorf("nil chain decoded %+v, %v", decoded, err)
+	}
+}
+
+func TestFileSchemaStore(t *testing.T) {
+	schema, err := NewFileSchemaStore(testSchemaDir).Schema(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Type != SchemaTypeProtobuf || !strings.Contains(schema.Text, "message Shipment") {
+		t.Errorf("schema 2 = %+v", schema)
+	}
+	if _, ok := schema.References["common/money.proto"]; !ok {
+		t.Errorf("references = %v, want common/money.proto", reflect.ValueOf(schema.References).MapKeys())
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
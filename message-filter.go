@@ -0,0 +1,627 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/IBM/sarama"
+)
+
+// MessageFilter is a compiled filter expression evaluated against every
+// record before it is sent to a client. Expressions combine predicates with
+// &&, || and !, and parentheses:
+//
+//	key == "order-42"
+//	key ^= "order-" || key =~ "^refund-[0-9]+$"
+//	header["source"] == "billing" && !header["retry"]
+//	$.type == "error" && $.value > 90
+//
+// Operands are key, value (the value as text, after schema decoding), header["name"],
+// partition, offset and JSONPath expressions on the value ($.a.b, $.items[0],
+// $["odd name"]). Operators are ==, !=, <, <=, >, >=, =~ (regex) and ^=
+// (prefix); a bare operand tests that it is present. A predicate on an
+// operand that is missing, e.g. a JSONPath on a non-JSON value, is false.
+type MessageFilter struct {
+	expr string
+	root filterNode
+}
+
+// CompileFilter parses expr. The returned error points at the offending
+// position so it can be shown to the user as is.
+func CompileFilter(expr string) (*MessageFilter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, filterError(tok, "unexpected %s", tok.describe())
+	}
+
+	return &MessageFilter{expr: expr, root: root}, nil
+}
+
+// FieldExtractor reads one operand, such as $.user.id or header["source"],
+// from records. It shares the operand syntax of filters.
+type FieldExtractor struct {
+	operand filterOperand
+}
+
+func CompileFieldExtractor(expr string) (*FieldExtractor, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+	operand, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, filterError(tok, "unexpected %s", tok.describe())
+	}
+	return &FieldExtractor{operand: operand}, nil
+}
+
+// extract reads the operand from the record in c. Sharing c between the
+// extractors of one record parses its JSON value only once.
+func (e *FieldExtractor) extract(c *filterContext) (interface{}, bool) {
+	return e.operand.resolve(c)
+}
+
+// Match reports whether msg passes the filter. A nil filter matches every
+// record.
+func (f *MessageFilter) Match(msg *sarama.ConsumerMessage) bool {
+	return f.MatchValue(msg, msg.Value)
+}
+
+// MatchValue is Match with value used in place of the record's value, so
+// JSONPath predicates can see a decoded payload.
+func (f *MessageFilter) MatchValue(msg *sarama.ConsumerMessage, value []byte) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.eval(&filterContext{msg: msg, rawValue: value})
+}
+
+func (f *MessageFilter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// filterContext carries the record being evaluated and its value decoded as
+// JSON, which is parsed at most once per record.
+type filterContext struct {
+	msg      *sarama.ConsumerMessage
+	rawValue []byte
+	parsed   bool
+	value    interface{}
+	isJSON   bool
+}
+
+func (c *filterContext) jsonValue() (interface{}, bool) {
+	if !c.parsed {
+		c.parsed = true
+		c.isJSON = json.Unmarshal(c.rawValue, &c.value) == nil
+	}
+	return c.value, c.isJSON
+}
+
+type filterNode interface {
+	eval(c *filterContext) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) eval(c *filterContext) bool { return n.left.eval(c) && n.right.eval(c) }
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) eval(c *filterContext) bool { return n.left.eval(c) || n.right.eval(c) }
+
+type notNode struct{ node filterNode }
+
+func (n notNode) eval(c *filterContext) bool { return !n.node.eval(c) }
+
+type existsNode struct{ operand filterOperand }
+
+func (n existsNode) eval(c *filterContext) bool {
+	v, ok := n.operand.resolve(c)
+	return ok && v != nil
+}
+
+type compareNode struct {
+	operand filterOperand
+	op      string
+	literal interface{}
+	regex   *regexp.Regexp
+}
+
+func (n compareNode) eval(c *filterContext) bool {
+	v, ok := n.operand.resolve(c)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "=~":
+		s, ok := v.(string)
+		return ok && n.regex.MatchString(s)
+	case "^=":
+		s, ok := v.(string)
+		return ok && strings.HasPrefix(s, n.literal.(string))
+	case "==":
+		return filterEqual(v, n.literal)
+	case "!=":
+		return !filterEqual(v, n.literal)
+	}
+
+	cmp, ok := filterCompare(v, n.literal)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func filterEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case nil:
+		return b == nil
+	}
+	return false
+}
+
+func filterCompare(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// filterOperand resolves to a string, float64, bool or nil. ok is false
+// when the operand doesn't exist on the record.
+type filterOperand interface {
+	resolve(c *filterContext) (v interface{}, ok bool)
+}
+
+type keyOperand struct{}
+
+func (keyOperand) resolve(c *filterContext) (interface{}, bool) {
+	if c.msg.Key == nil {
+		return nil, false
+	}
+	return string(c.msg.Key), true
+}
+
+type valueOperand struct{}
+
+func (valueOperand) resolve(c *filterContext) (interface{}, bool) {
+	if c.rawValue == nil {
+		return nil, false
+	}
+	return string(c.rawValue), true
+}
+
+type headerOperand struct{ name string }
+
+func (h headerOperand) resolve(c *filterContext) (interface{}, bool) {
+	for _, header := range c.msg.Headers {
+		if string(header.Key) == h.name {
+			return string(header.Value), true
+		}
+	}
+	return nil, false
+}
+
+type partitionOperand struct{}
+
+func (partitionOperand) resolve(c *filterContext) (interface{}, bool) {
+	return float64(c.msg.Partition), true
+}
+
+type offsetOperand struct{}
+
+func (offsetOperand) resolve(c *filterContext) (interface{}, bool) {
+	return float64(c.msg.Offset), true
+}
+
+// jsonPathOperand walks the decoded value. Each step is a string (object
+// field) or an int (array index).
+type jsonPathOperand struct{ path []interface{} }
+
+func (j jsonPathOperand) resolve(c *filterContext) (interface{}, bool) {
+	v, ok := c.jsonValue()
+	if !ok {
+		return nil, false
+	}
+
+	for _, step := range j.path {
+		switch step := step.(type) {
+		case string:
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = object[step]; !ok {
+				return nil, false
+			}
+		case int:
+			array, ok := v.([]interface{})
+			if !ok || step < 0 || step >= len(array) {
+				return nil, false
+			}
+			v = array[step]
+		}
+	}
+	return v, true
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokOp, "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokOp, "&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	tok := p.peek()
+	switch {
+	case tok.is(tokOp, "!"):
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	case tok.kind == tokLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, filterError(closing, "expected ) but found %s", closing.describe())
+		}
+		return node, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *filterParser) parsePredicate() (filterNode, error) {
+	operand, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	opTok := p.peek()
+	if opTok.kind != tokOp || !isComparison(opTok.text) {
+		return existsNode{operand}, nil
+	}
+	p.next()
+
+	litTok := p.next()
+	if litTok.kind != tokString && litTok.kind != tokNumber && litTok.kind != tokLiteral {
+		return nil, filterError(litTok, "expected a string, number, true, false or null after %s but found %s", opTok.text, litTok.describe())
+	}
+
+	node := compareNode{operand: operand, op: opTok.text, literal: litTok.value}
+	switch opTok.text {
+	case "=~":
+		pattern, ok := litTok.value.(string)
+		if !ok {
+			return nil, filterError(litTok, "=~ needs a quoted regular expression")
+		}
+		node.regex, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, filterError(litTok, "invalid regular expression: %v", err)
+		}
+	case "^=":
+		if _, ok := litTok.value.(string); !ok {
+			return nil, filterError(litTok, "^= needs a quoted prefix")
+		}
+	}
+	return node, nil
+}
+
+func (p *filterParser) parseOperand() (filterOperand, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokPath:
+		return jsonPathOperand{path: tok.path}, nil
+	case tok.is(tokIdent, "key"):
+		return keyOperand{}, nil
+	case tok.is(tokIdent, "value"):
+		return valueOperand{}, nil
+	case tok.is(tokIdent, "partition"):
+		return partitionOperand{}, nil
+	case tok.is(tokIdent, "offset"):
+		return offsetOperand{}, nil
+	case tok.is(tokIdent, "header"):
+		if open := p.next(); open.kind != tokLBracket {
+			return nil, filterError(open, "expected [ after header but found %s", open.describe())
+		}
+		name := p.next()
+		if name.kind != tokString {
+			return nil, filterError(name, "expected a quoted header name but found %s", name.describe())
+		}
+		if closing := p.next(); closing.kind != tokRBracket {
+			return nil, filterError(closing, "expected ] but found %s", closing.describe())
+		}
+		return headerOperand{name: name.value.(string)}, nil
+	}
+	return nil, filterError(tok, "expected key, value, header[\"name\"], partition, offset or a $ path but found %s", tok.describe())
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "^=":
+		return true
+	}
+	return false
+}
+
+type filterTokenKind int
+
+const (
+	tokEOF filterTokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokLiteral // true, false or null
+	tokPath
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	text  string
+	pos   int
+	value interface{}
+	path  []interface{}
+}
+
+func (t filterToken) is(kind filterTokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t filterToken) describe() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+func filterError(tok filterToken, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid filter at position %d: %s", tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+var filterDelimiters = map[byte]filterTokenKind{'(': tokLParen, ')': tokRParen, '[': tokLBracket, ']': tokRBracket}
+
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "^=", "<", ">", "!"}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, filterToken{kind: filterDelimiters[c], text: string(c), pos: i})
+			i++
+		case c == '"':
+			s, n, err := lexFilterString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter at position %d: %v", i+1, err)
+			}
+			tokens = append(tokens, filterToken{kind: tokString, text: expr[i : i+n], pos: i, value: s})
+			i += n
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '.' || expr[j] == 'e' || expr[j] == 'E' || (expr[j] >= '0' && expr[j] <= '9')) {
+				j++
+			}
+			n, err := strconv.ParseFloat(expr[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter at position %d: invalid number %q", i+1, expr[i:j])
+			}
+			tokens = append(tokens, filterToken{kind: tokNumber, text: expr[i:j], pos: i, value: n})
+			i = j
+		case c == '$':
+			path, n, err := lexJSONPath(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter at position %d: %v", i+1, err)
+			}
+			tokens = append(tokens, filterToken{kind: tokPath, text: expr[i : i+n], pos: i, path: path})
+			i += n
+		case isIdentRune(rune(c)):
+			j := i
+			for j < len(expr) && isIdentRune(rune(expr[j])) {
+				j++
+			}
+			word := expr[i:j]
+			tok := filterToken{kind: tokIdent, text: word, pos: i}
+			switch word {
+			case "true":
+				tok.kind, tok.value = tokLiteral, true
+			case "false":
+				tok.kind, tok.value = tokLiteral, false
+			case "null":
+				tok.kind, tok.value = tokLiteral, nil
+			}
+			tokens = append(tokens, tok)
+			i = j
+		default:
+			op := ""
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("invalid filter at position %d: unexpected character %q", i+1, c)
+			}
+			tokens = append(tokens, filterToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, filterToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// lexFilterString reads a double-quoted string with Go escapes from the
+// start of s and returns it with the number of bytes consumed.
+func lexFilterString(s string) (string, int, error) {
+	for j := 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			value, err := strconv.Unquote(s[:j+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:j+1])
+			}
+			return value, j + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// lexJSONPath reads $ followed by .field, [index] and ["field"] steps.
+func lexJSONPath(s string) ([]interface{}, int, error) {
+	path := []interface{}{}
+	i := 1
+	for i < len(s) {
+		switch s[i] {
+		case '.':
+			j := i + 1
+			for j < len(s) && isIdentRune(rune(s[j])) {
+				j++
+			}
+			if j == i+1 {
+				return nil, 0, fmt.Errorf("expected a field name after . in %s", s[:j])
+			}
+			path = append(path, s[i+1:j])
+			i = j
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if i+1 < len(s) && s[i+1] == '"' {
+				field, n, err := lexFilterString(s[i+1:])
+				if err != nil {
+					return nil, 0, err
+				}
+				end = i + 1 + n
+				if end >= len(s) || s[end] != ']' {
+					return nil, 0, fmt.Errorf("expected ] after %s", s[i+1:end])
+				}
+				path = append(path, field)
+				i = end + 1
+				continue
+			}
+			if end < 0 {
+				return nil, 0, fmt.Errorf("unterminated [ in path")
+			}
+			index, err := strconv.Atoi(s[i+1 : i+end])
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid array index %q in path", s[i+1:i+end])
+			}
+			path = append(path, index)
+			i += end + 1
+		default:
+			return path, i, nil
+		}
+	}
+	return path, i, nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+var filterRecord = &sarama.ConsumerMessage{
+	Key:       []byte("order-42"),
+	Value:     []byte(`{"type": "error", "value": 95, "items": [1, 2], "ok": false, "odd name": "x"}`),
+	Headers:   []*sarama.RecordHeader{{Key: []byte("source"), Value: []byte("billing")}},
+	Partition: 3,
+	Offset:    100,
+}
+
+func TestMessageFilterMatch(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want bool
+	}{
+		{`key == "order-42"`, true},
+		{`key != "order-42"`, false},
+		{`key ^= "order-"`, true},
+		{`key =~ "^refund-[0-9]+$"`, false},
+		{`key ^= "order-" || key =~ "^refund-[0-9]+$"`, true},
+		{`header["source"] == "billing" && !header["retry"]`, true},
+		{`header["retry"]`, false},
+		{`$.type == "error" && $.value > 90`, true},
+		{`$.value <= 90`, false},
+		{`$.value >= 95 && $.value < 95.5`, true},
+		{`$.items[0] == 1`, true},
+		{`$.items[5]`, false},
+		{`$["odd name"] == "x"`, true},
+		{`$.ok == false`, true},
+		{`$.missing`, false},
+		{`!$.missing`, true},
+		{`$.type > 5`, false},
+		{`partition == 3 && offset >= 100`, true},
+		{`(key == "other" || $.type == "error") && partition != 4`, true},
+		{`!(key == "order-42")`, false},
+		{`value ^= "{"`, true},
+	} {
+		filter, err := CompileFilter(tc.expr)
+		if err != nil {
+			t.Errorf("CompileFilter(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := filter.Match(filterRecord); got != tc.want {
+			t.Errorf("%q matched %v, want %v", tc.expr, got, tc.want)
+		}
+		if filter.String() != tc.expr {
+			t.Errorf("String() = %q, want %q", filter.String(), tc.expr)
+		}
+	}
+}
+
+func TestMessageFilterNonJSONValue(t *testing.T) {
+	filter, err := CompileFilter(`$.type == "error" || key == "plain"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Match(&sarama.ConsumerMessage{Key: []byte("other"), Value: []byte("not json")}) {
+		t.Error("JSONPath matched a value that isn't JSON")
+	}
+	if !filter.Match(&sarama.ConsumerMessage{Key: []byte("plain"), Value: []byte("not json")}) {
+		t.Error("key predicate didn't match")
+	}
+	if !filter.MatchValue(&sarama.ConsumerMessage{}, []byte(`{"type": "error"}`)) {
+		t.Error("MatchValue didn't use the given value")
+	}
+}
+
+func TestMessageFilterNil(t *testing.T) {
+	var filter *MessageFilter
+	if !filter.Match(filterRecord) || filter.String() != "" {
+		t.Error("a nil filter should match everything")
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr     string
+		position int
+	}{
+		{`key ==`, 7},
+		{`key == "order-42" &&`, 21},
+		{`(key == "a"`, 12},
+		{`topic == "a"`, 1},
+		{`header[source] == "a"`, 8},
+		{`header["source" == "a"`, 17},
+		{`key =~ "["`, 8},
+		{`key =~ 5`, 8},
+		{`key ^= true`, 8},
+		{`key == "a" key`, 12},
+		{`key == "a`, 8},
+	} {
+		_, err := CompileFilter(tc.expr)
+		if err == nil {
+			t.Errorf("CompileFilter(%q) succeeded", tc.expr)
+			continue
+		}
+		if want := fmt.Sprintf("invalid filter at position %d:", tc.position); !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("CompileFilter(%q) = %v, want an error starting with %q", tc.expr, err, want)
+		}
+	}
+}
+
+func TestCompileFieldExtractor(t *testing.T) {
+	extractor, err := CompileFieldExtractor(`$.items[1]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := extractor.extract(&filterContext{msg: filterRecord, rawValue: filterRecord.Value})
+	if !ok || got != float64(2) {
+		t.Errorf("extract = %v, %v; want 2, true", got, ok)
+	}
+
+	if _, err := CompileFieldExtractor(`$.a == 1`); err == nil {
+		t.Error("a comparison compiled as a field extractor")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	maxProduceBatch     = 1000
+	maxProduceBodyBytes = 10 << 20
+)
+
+// ProduceRecord is one record in a POST /topics/{name}/messages request.
+// Value may be a JSON string, which is sent as its text, or any other JSON
+// value, which is sent as serialised JSON. With Encoding "base64" the key,
+// a string value and header values are base64 decoded first, for binary
+// payloads. Without a Partition the key decides the partition.
+type ProduceRecord struct {
+	Key       *string         `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Headers   []ProduceHeader `json:"headers"`
+	Partition *int32          `json:"partition"`
+	Timestamp *time.Time      `json:"timestamp"`
+	Encoding  string          `json:"encoding"`
+}
+
+type ProduceHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ProduceResult reports where a record was written, or why it wasn't.
+type ProduceResult struct {
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Error     string `json:"error,omitempty"`
+}
+
+// explicitPartition marks a message whose Partition was chosen by the
+// caller.
+type explicitPartition struct{}
+
+// recordPartitioner honours an explicit partition and otherwise hashes the
+// key like the default partitioner.
+type recordPartitioner struct {
+	hash sarama.Partitioner
+}
+
+func newRecordPartitioner(topic string) sarama.Partitioner {
+	return &recordPartitioner{hash: sarama.NewHashPartitioner(topic)}
+}
+
+func (p *recordPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if _, ok := msg.Metadata.(explicitPartition); ok {
+		if msg.Partition < 0 || msg.Partition >= numPartitions {
+			return 0, sarama.ErrInvalidPartition
+		}
+		return msg.Partition, nil
+	}
+	return p.hash.Partition(msg, numPartitions)
+}
+
+func (p *recordPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// producer returns the server's SyncProducer, creating it on first use. It
+// shares the server's client and therefore its SASL and TLS settings.
+func (s *Server) producer() (sarama.SyncProducer, error) {
+	s.producerMu.Lock()
+	defer s.producerMu.Unlock()
+
+	if s.syncProducer != nil {
+		return s.syncProducer, nil
+	}
+	if s.kafkaConn == nil {
+		return nil, fmt.Errorf("no Kafka client configured")
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(s.kafkaConn)
+	if err != nil {
+		return nil, err
+	}
+	s.syncProducer = producer
+	return producer, nil
+}
+
+// produceMessages accepts a single record object or an array of them and
+// responds with a result, or an array of results, in the same shape.
+func (s *Server) produceMessages(w http.ResponseWriter, r *http.Request, topic string) {
+	body := http.MaxBytesReader(w, r.Body, maxProduceBodyBytes)
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	batch := len(bytes.TrimSpace(raw)) > 0 && bytes.TrimSpace(raw)[0] == '['
+	var records []ProduceRecord
+	if batch {
+		if err := json.Unmarshal(raw, &records); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid records: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var record ProduceRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid record: %v", err), http.StatusBadRequest)
+			return
+		}
+		records = []ProduceRecord{record}
+	}
+	if len(records) == 0 {
+		http.Error(w, "No records to produce", http.StatusBadRequest)
+		return
+	}
+	if len(records) > maxProduceBatch {
+		http.Error(w, fmt.Sprintf("At most %d records can be produced per request", maxProduceBatch), http.StatusBadRequest)
+		return
+	}
+
+	messages := make([]*sarama.ProducerMessage, len(records))
+	for i, record := range records {
+		msg, err := record.producerMessage(topic)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid record %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		messages[i] = msg
+	}
+
+	producer, err := s.producer()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create producer: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	failed := make(map[*sarama.ProducerMessage]error)
+	if err := producer.SendMessages(messages); err != nil {
+		var producerErrors sarama.ProducerErrors
+		if !errors.As(err, &producerErrors) {
+			http.Error(w, fmt.Sprintf("Failed to produce messages: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, producerError := range producerErrors {
+			failed[producerError.Msg] = producerError.Err
+		}
+	}
+
+	results := make([]ProduceResult, len(messages))
+	for i, msg := range messages {
+		if err, ok := failed[msg]; ok {
+			results[i] = ProduceResult{Partition: -1, Offset: -1, Error: err.Error()}
+			continue
+		}
+		results[i] = ProduceResult{Partition: msg.Partition, Offset: msg.Offset}
+	}
+
+	if !batch {
+		if err, ok := failed[messages[0]]; ok {
+			http.Error(w, fmt.Sprintf("Failed to produce message: %v", err), produceErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results[0])
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// produceErrorStatus tells records Kafka rejected, which fail the same way
+// when retried, from broker and transport failures.
+func produceErrorStatus(err error) int {
+	var configErr sarama.ConfigurationError
+	switch {
+	case errors.Is(err, sarama.ErrUnknownTopicOrPartition):
+		return http.StatusNotFound
+	case errors.Is(err, sarama.ErrInvalidPartition), errors.As(err, &configErr):
+		return http.StatusBadRequest
+	}
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		switch kerr {
+		case sarama.ErrInvalidMessage, sarama.ErrMessageSizeTooLarge, sarama.ErrMessageSetSizeTooLarge,
+			sarama.ErrInvalidTopic, sarama.ErrInvalidTimestamp, sarama.ErrInvalidRecord,
+			sarama.ErrPolicyViolation:
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func (r ProduceRecord) producerMessage(topic string) (*sarama.ProducerMessage, error) {
+	decode := func(s string) ([]byte, error) { return []byte(s), nil }
+	switch r.Encoding {
+	case "", "utf8":
+	case "base64":
+		decode = base64.StdEncoding.DecodeString
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", r.Encoding)
+	}
+
+	msg := &sarama.ProducerMessage{Topic: topic}
+
+	if r.Key != nil {
+		key, err := decode(*r.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %w", err)
+		}
+		msg.Key = sarama.ByteEncoder(key)
+	}
+
+	// A missing or null value produces a tombstone.
+	if len(r.Value) > 0 && string(r.Value) != "null" {
+		var text string
+		if json.Unmarshal(r.Value, &text) == nil {
+			value, err := decode(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value: %w", err)
+			}
+			msg.Value = sarama.ByteEncoder(value)
+		} else {
+			msg.Value = sarama.ByteEncoder(r.Value)
+		}
+	}
+
+	for _, header := range r.Headers {
+		value, err := decode(header.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %w", header.Key, err)
+		}
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(header.Key), Value: value})
+	}
+
+	if r.Partition != nil {
+		msg.Partition = *r.Partition
+		msg.Metadata = explicitPartition{}
+	}
+	if r.Timestamp != nil {
+		msg.Timestamp = *r.Timestamp
+	}
+	return msg, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestProduceErrorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{sarama.ErrInvalidPartition, http.StatusBadRequest},
+		{sarama.ErrMessageSizeTooLarge, http.StatusBadRequest},
+		{sarama.ConfigurationError("Attempt to produce message larger than configured Producer.MaxMessageBytes"), http.StatusBadRequest},
+		{fmt.Errorf("partition 3: %w", sarama.ErrInvalidRecord), http.StatusBadRequest},
+		{sarama.ErrUnknownTopicOrPartition, http.StatusNotFound},
+		{sarama.ErrNotLeaderForPartition, http.StatusInternalServerError},
+		{sarama.ErrOutOfBrokers, http.StatusInternalServerError},
+		{fmt.Errorf("dial tcp: connection refused"), http.StatusInternalServerError},
+	} {
+		if got := produceErrorStatus(tc.err); got != tc.want {
+			t.Errorf("produceErrorStatus(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ClusterMetadataSource is everything the Server needs to know about a
+// cluster's layout. Implementations exist for the Kafka protocol, legacy
+// ZooKeeper znodes and an in-memory fake.
+type ClusterMetadataSource interface {
+	ListTopics() ([]string, error)
+	DescribeTopics(topics []string) ([]TopicMetadata, error)
+	ListBrokers() ([]BrokerInfo, error)
+	PartitionOffsets(topic string) (map[int32]PartitionOffsets, error)
+	// Watch delivers an event whenever the topic or broker set may have
+	// changed, until done is closed.
+	Watch(done <-chan struct{}) <-chan MetadataEvent
+	Close() error
+}
+
+type TopicMetadata struct {
+	Name       string
+	Partitions []PartitionMetadata
+}
+
+type PartitionMetadata struct {
+	ID       int32
+	Leader   int32
+	Replicas []int32
+	ISR      []int32
+}
+
+type PartitionOffsets struct {
+	Oldest int64
+	Newest int64
+}
+
+type MetadataEvent struct {
+	Type string
+}
+
+const (
+	MetadataEventTopics  = "topics"
+	MetadataEventBrokers = "brokers"
+)
+
+// ReplicationFactor returns the replica count of the first partition; all
+// partitions of a topic are assumed to share it.
+func (t TopicMetadata) ReplicationFactor() int {
+	if len(t.Partitions) == 0 {
+		return 0
+	}
+	return len(t.Partitions[0].Replicas)
+}
+
+// KafkaMetadataSource reads metadata purely through the Kafka protocol and
+// therefore works against KRaft clusters.
+type KafkaMetadataSource struct {
+	client       sarama.Client
+	pollInterval time.Duration
+}
+
+func NewKafkaMetadataSource(client sarama.Client) *KafkaMetadataSource {
+	return &KafkaMetadataSource{
+		client:       client,
+		pollInterval: 10 * time.Second,
+	}
+}
+
+func (k *KafkaMetadataSource) ListTopics() ([]string, error) {
+	if err := k.client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+	return k.client.Topics()
+}
+
+func (k *KafkaMetadataSource) DescribeTopics(topics []string) ([]TopicMetadata, error) {
+	if err := k.client.RefreshMetadata(topics...); err != nil {
+		return nil, err
+	}
+
+	metadata := make([]TopicMetadata, 0, len(topics))
+	for _, topic := range topics {
+		partitions, err := k.client.Partitions(topic)
+		if err != nil {
+			return nil, err
+		}
+
+		topicMetadata := TopicMetadata{Name: topic}
+		for _, partition := range partitions {
+			replicas, err := k.client.Replicas(topic, partition)
+			if err != nil {
+				return nil, err
+			}
+			isr, err := k.client.InSyncReplicas(topic, partition)
+			if err != nil {
+				return nil, err
+			}
+
+			// An offline partition has no leader; report it as -1 rather
+			// than failing the whole topic.
+			leaderID := int32(-1)
+			if leader, err := k.client.Leader(topic, partition); err == nil {
+				leaderID = leader.ID()
+			}
+
+			topicMetadata.Partitions = append(topicMetadata.Partitions, PartitionMetadata{
+				ID:       partition,
+				Leader:   leaderID,
+				Replicas: replicas,
+				ISR:      isr,
+			})
+		}
+		sortPartitions(topicMetadata.Partitions)
+		metadata = append(metadata, topicMetadata)
+	}
+
+	return metadata, nil
+}
+
+func (k *KafkaMetadataSource) ListBrokers() ([]BrokerInfo, error) {
+	if err := k.client.RefreshMetadata(); err != nil {
+		return nil, err
+	}
+
+	brokers := k.client.Brokers()
+	brokerInfo := make([]BrokerInfo, 0, len(brokers))
+	for _, broker := range brokers {
+		host, port, err := net.SplitHostPort(broker.Addr())
+		if err != nil {
+			return nil, err
+		}
+		brokerInfo = append(brokerInfo, BrokerInfo{
+			ID:       broker.ID(),
+			Hostname: host,
+			Port:     int32(mustAtoi(port)),
+			Rack:     broker.Rack(),
+		})
+	}
+	sortBrokers(brokerInfo)
+
+	return brokerInfo, nil
+}
+
+func (k *KafkaMetadataSource) PartitionOffsets(topic string) (map[int32]PartitionOffsets, error) {
+	return clientPartitionOffsets(k.client, topic)
+}
+
+// Watch polls Kafka metadata, since the protocol has no change
+// notifications, and emits an event when the topic or broker set changes.
+func (k *KafkaMetadataSource) Watch(done <-chan struct{}) <-chan MetadataEvent {
+	events := make(chan MetadataEvent)
+
+	go func() {
+		defer close(events)
+
+		var lastTopics, lastBrokers *string
+		for {
+			if topics, err := k.ListTopics(); err == nil {
+				sort.Strings(topics)
+				key := strings.Join(topics, ",")
+				if lastTopics != nil && key != *lastTopics {
+					if !sendEvent(events, done, MetadataEvent{Type: MetadataEventTopics}) {
+						return
+					}
+				}
+				lastTopics = &key
+			}
+
+			if brokers, err := k.ListBrokers(); err == nil {
+				key := brokerKey(brokers)
+				if lastBrokers != nil && key != *lastBrokers {
+					if !sendEvent(events, done, MetadataEvent{Type: MetadataEventBrokers}) {
+						return
+					}
+				}
+				lastBrokers = &key
+			}
+
+			select {
+			case <-done:
+				return
+			case <-time.After(k.pollInterval):
+			}
+		}
+	}()
+
+	return events
+}
+
+// Close is a no-op; the client is owned by the Server.
+func (k *KafkaMetadataSource) Close() error {
+	return nil
+}
+
+func clientPartitionOffsets(client sarama.Client, topic string) (map[int32]PartitionOffsets, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int32]PartitionOffsets, len(partitions))
+	for _, partition := range partitions {
+		oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		offsets[partition] = PartitionOffsets{Oldest: oldest, Newest: newest}
+	}
+
+	return offsets, nil
+}
+
+func sendEvent(events chan<- MetadataEvent, done <-chan struct{}, event MetadataEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func sortPartitions(partitions []PartitionMetadata) {
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].ID < partitions[j].ID
+	})
+}
+
+func sortBrokers(brokers []BrokerInfo) {
+	sort.Slice(brokers, func(i, j int) bool {
+		return brokers[i].ID < brokers[j].ID
+	})
+}
+
+func brokerKey(brokers []BrokerInfo) string {
+	ids := make([]string, len(brokers))
+	for i, broker := range brokers {
+		ids[i] = fmt.Sprintf("%d@%s:%d", broker.ID, broker.Hostname, broker.Port)
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// minISRTTL is how long a topic's min.insync.replicas is cached; describing
+// every topic's config on every refresh would be wasteful.
+const minISRTTL = 5 * time.Minute
+
+// PartitionProblem is a partition with a replication problem. OutOfSync
+// lists the replicas missing from the ISR. MinISR is the topic's
+// min.insync.replicas, or 0 when it couldn't be read.
+type PartitionProblem struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Leader    int32   `json:"leader"`
+	Replicas  []int32 `json:"replicas"`
+	ISR       []int32 `json:"isr"`
+	OutOfSync []int32 `json:"outOfSync"`
+	MinISR    int     `json:"minIsr,omitempty"`
+}
+
+// ImplicatedBroker is a broker hosting replicas of unhealthy partitions.
+// Live is false when the broker isn't registered with the cluster.
+type ImplicatedBroker struct {
+	Broker            int32 `json:"broker"`
+	Live              bool  `json:"live"`
+	OutOfSyncReplicas int   `json:"outOfSyncReplicas"`
+	OfflinePartitions int   `json:"offlinePartitions"`
+}
+
+type PartitionHealthCounts struct {
+	UnderReplicated int `json:"underReplicated"`
+	BelowMinISR     int `json:"belowMinIsr"`
+	AtMinISR        int `json:"atMinIsr"`
+	Offline         int `json:"offline"`
+}
+
+// PartitionHealth lists under-replicated partitions (ISR smaller than the
+// replica set), partitions whose ISR is below or exactly at the topic's
+// min.insync.replicas, and offline partitions (no leader). Offline
+// partitions are not repeated in the other lists.
+type PartitionHealth struct {
+	PartitionHealthCounts
+	UnderReplicated []PartitionProblem `json:"underReplicatedPartitions"`
+	BelowMinISR     []PartitionProblem `json:"belowMinIsrPartitions"`
+	AtMinISR        []PartitionProblem `json:"atMinIsrPartitions"`
+	Offline         []PartitionProblem `json:"offlinePartitions"`
+	Brokers         []ImplicatedBroker `json:"brokers"`
+	LastUpdated     time.Time          `json:"lastUpdated"`
+}
+
+func partitionHealth(topics []TopicMetadata, brokers []BrokerInfo, minISR map[string]int) *PartitionHealth {
+	health := &PartitionHealth{
+		UnderReplicated: []PartitionProblem{},
+		BelowMinISR:     []PartitionProblem{},
+		AtMinISR:        []PartitionProblem{},
+		Offline:         []PartitionProblem{},
+		Brokers:         []ImplicatedBroker{},
+	}
+	live := make(map[int32]bool, len(brokers))
+	for _, broker := range brokers {
+		live[broker.ID] = true
+	}
+	implicated := make(map[int32]*ImplicatedBroker)
+	broker := func(id int32) *ImplicatedBroker {
+		if _, ok := implicated[id]; !ok {
+			implicated[id] = &ImplicatedBroker{Broker: id, Live: live[id]}
+		}
+		return implicated[id]
+	}
+
+	for _, topic := range topics {
+		for _, partition := range topic.Partitions {
+			problem := PartitionProblem{
+				Topic:     topic.Name,
+				Partition: partition.ID,
+				Leader:    partition.Leader,
+				Replicas:  partition.Replicas,
+				ISR:       partition.ISR,
+				OutOfSync: []int32{},
+				MinISR:    minISR[topic.Name],
+			}
+			for _, replica := range partition.Replicas {
+				if !slices.Contains(partition.ISR, replica) {
+					problem.OutOfSync = append(problem.OutOfSync, replica)
+				}
+			}
+
+			if partition.Leader < 0 {
+				health.Offline = append(health.Offline, problem)
+				for _, replica := range partition.Replicas {
+					broker(replica).OfflinePartitions++
+				}
+				continue
+			}
+			if len(problem.OutOfSync) > 0 {
+				health.UnderReplicated = append(health.UnderReplicated, problem)
+				for _, replica := range problem.OutOfSync {
+					broker(replica).OutOfSyncReplicas++
+				}
+			}
+			switch {
+			case problem.MinISR == 0:
+			case len(partition.ISR) < problem.MinISR:
+				health.BelowMinISR = append(health.BelowMinISR, problem)
+			case len(partition.ISR) == problem.MinISR:
+				health.AtMinISR = append(health.AtMinISR, problem)
+			}
+		}
+	}
+
+	for _, b := range implicated {
+		health.Brokers = append(health.Brokers, *b)
+	}
+	sort.Slice(health.Brokers, func(i, j int) bool { return health.Brokers[i].Broker < health.Brokers[j].Broker })
+	health.PartitionHealthCounts = PartitionHealthCounts{
+		UnderReplicated: len(health.UnderReplicated),
+		BelowMinISR:     len(health.BelowMinISR),
+		AtMinISR:        len(health.AtMinISR),
+		Offline:         len(health.Offline),
+	}
+	return health
+}
+
+// equal reports whether two reports list the same problems, ignoring when
+// they were built.
+func (h *PartitionHealth) equal(other *PartitionHealth) bool {
+	if h == nil || other == nil {
+		return h == other
+	}
+	a, b := *h, *other
+	a.LastUpdated, b.LastUpdated = time.Time{}, time.Time{}
+	return reflect.DeepEqual(a, b)
+}
+
+type minISREntry struct {
+	value   int
+	ok      bool
+	fetched time.Time
+}
+
+// minISRCache holds each topic's effective min.insync.replicas. Topics
+// that couldn't be described are cached too, so they aren't asked for on
+// every refresh.
+type minISRCache struct {
+	mu      sync.Mutex
+	entries map[string]minISREntry
+}
+
+// get returns min.insync.replicas for topics, describing the configs of
+// topics that aren't cached or have expired in one request. Topics that
+// can't be described are left out, and topics not listed are forgotten.
+func (c *minISRCache) get(s *Server, topics []string) map[string]int {
+	values := make(map[string]int, len(topics))
+	var missing []string
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]minISREntry)
+	}
+	listed := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		listed[topic] = true
+		entry, ok := c.entries[topic]
+		switch {
+		case !ok || time.Since(entry.fetched) >= minISRTTL:
+			missing = append(missing, topic)
+		case entry.ok:
+			values[topic] = entry.value
+		}
+	}
+	for topic := range c.entries {
+		if !listed[topic] {
+			delete(c.entries, topic)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 || s.kafkaConn == nil {
+		return values
+	}
+
+	fetched, err := describeMinISR(s.kafkaConn, missing)
+	if err != nil {
+		log.Printf("Failed to describe min.insync.replicas of %d topics: %v", len(missing), err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, topic := range missing {
+		value, ok := fetched[topic]
+		c.entries[topic] = minISREntry{value: value, ok: ok, fetched: now}
+		if ok {
+			values[topic] = value
+		}
+	}
+	return values
+}
+
+// describeMinISR describes min.insync.replicas of topics in a single
+// DescribeConfigs request. Topics the broker reports an error for are left
+// out.
+func describeMinISR(client sarama.Client, topics []string) (map[string]int, error) {
+	broker := client.LeastLoadedBroker()
+	if broker == nil {
+		return nil, sarama.ErrBrokerNotAvailable
+	}
+	_ = broker.Open(client.Config())
+
+	request := &sarama.DescribeConfigsRequest{}
+	if client.Config().Version.IsAtLeast(sarama.V2_0_0_0) {
+		request.Version = 2
+	} else if client.Config().Version.IsAtLeast(sarama.V1_1_0_0) {
+		request.Version = 1
+	}
+	for _, topic := range topics {
+		request.Resources = append(request.Resources, &sarama.ConfigResource{
+			Type:        sarama.TopicResource,
+			Name:        topic,
+			ConfigNames: []string{"min.insync.replicas"},
+		})
+	}
+	response, err := broker.DescribeConfigs(request)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int, len(topics))
+	for _, resource := range response.Resources {
+		if resource.ErrorCode != 0 {
+			log.Printf("Failed to describe min.insync.replicas of topic %s: %v", resource.Name, sarama.KError(resource.ErrorCode))
+			continue
+		}
+		for _, entry := range resource.Configs {
+			if entry.Name != "min.insync.replicas" {
+				continue
+			}
+			if value, err := strconv.Atoi(entry.Value); err == nil {
+				values[resource.Name] = value
+			}
+		}
+	}
+	return values, nil
+}
+
+func (s *Server) servePartitionHealth(w http.ResponseWriter, r *http.Request) {
+	health := s.currentClusterStatus().health
+	if health == nil {
+		http.Error(w, "Partition health is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// servePartitionHealthWebSocket sends the current partition health and then
+// a new report each time the set of unhealthy partitions changes.
+func (s *Server) servePartitionHealthWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var sent *PartitionHealth
+	for {
+		if status := s.clusterStatus.Load(); status != nil && status.health != nil && (sent == nil || !sent.equal(status.health)) {
+			if err := conn.WriteJSON(status.health); err != nil {
+				log.Println("WebSocket write error:", err)
+				return
+			}
+			sent = status.health
+		}
+
+		select {
+		case <-ticker.C:
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// paymentsTopic has a healthy partition, one at and one below
+// min.insync.replicas 2, and an offline one on broker 4, which isn't live.
+var paymentsTopic = TopicMetadata{
+	Name: "payments",
+	Partitions: []PartitionMetadata{
+		{ID: 0, Leader: 1, Replicas: []int32{1, 2, 3}, ISR: []int32{1, 2, 3}},
+		{ID: 1, Leader: 1, Replicas: []int32{1, 2, 3}, ISR: []int32{1, 2}},
+		{ID: 2, Leader: 1, Replicas: []int32{1, 2, 3}, ISR: []int32{1}},
+		{ID: 3, Leader: -1, Replicas: []int32{3, 4}, ISR: []int32{}},
+	},
+}
+
+func TestPartitionHealth(t *testing.T) {
+	health := partitionHealth([]TopicMetadata{paymentsTopic}, testBrokers(1, 2, 3), map[string]int{"payments": 2})
+
+	wantCounts := PartitionHealthCounts{UnderReplicated: 2, BelowMinISR: 1, AtMinISR: 1, Offline: 1}
+	if health.PartitionHealthCounts != wantCounts {
+		t.Errorf("counts = %+v, want %+v", health.PartitionHealthCounts, wantCounts)
+	}
+
+	partitions := func(problems []PartitionProblem) []int32 {
+		ids := []int32{}
+		for _, problem := range problems {
+			ids = append(ids, problem.Partition)
+		}
+		return ids
+	}
+	for _, list := range []struct {
+		name     string
+		problems []PartitionProblem
+		want     []int32
+	}{
+		{"UnderReplicated", health.UnderReplicated, []int32{1, 2}},
+		{"BelowMinISR", health.BelowMinISR, []int32{2}},
+		{"AtMinISR", health.AtMinISR, []int32{1}},
+		{"Offline", health.Offline, []int32{3}},
+	} {
+		if got := partitions(list.problems); !reflect.DeepEqual(got, list.want) {
+			t.Errorf("%s = %v, want %v", list.name, got, list.want)
+		}
+	}
+	if got := health.UnderReplicated[1].OutOfSync; !reflect.DeepEqual(got, []int32{2, 3}) {
+		t.Errorf("OutOfSync of partition 2 = %v, want [2 3]", got)
+	}
+
+	wantBrokers := []ImplicatedBroker{
+		{Broker: 2, Live: true, OutOfSyncReplicas: 1},
+		{Broker: 3, Live: true, OutOfSyncReplicas: 2, OfflinePartitions: 1},
+		{Broker: 4, Live: false, OfflinePartitions: 1},
+	}
+	if !reflect.DeepEqual(health.Brokers, wantBrokers) {
+		t.Errorf("Brokers = %+v, want %+v", health.Brokers, wantBrokers)
+	}
+}
+
+func TestPartitionHealthWithoutMinISR(t *testing.T) {
+	health := partitionHealth([]TopicMetadata{paymentsTopic}, testBrokers(1, 2, 3), nil)
+	if health.BelowMinISR == nil || len(health.BelowMinISR) != 0 || len(health.AtMinISR) != 0 {
+		t.Errorf("got below %v and at %v min ISR, want none when min.insync.replicas is unknown", health.BelowMinISR, health.AtMinISR)
+	}
+	if health.UnderReplicated[0].MinISR != 0 {
+		t.Errorf("MinISR = %d, want 0", health.UnderReplicated[0].MinISR)
+	}
+}
+
+func TestPartitionHealthEqual(t *testing.T) {
+	a := partitionHealth([]TopicMetadata{paymentsTopic}, testBrokers(1, 2, 3), nil)
+	b := partitionHealth([]TopicMetadata{paymentsTopic}, testBrokers(1, 2, 3), nil)
+	b.LastUpdated = a.LastUpdated.Add(1)
+	if !a.equal(b) {
+		t.Error("reports differing only in LastUpdated should be equal")
+	}
+
+	healthy := partitionHealth([]TopicMetadata{ordersTopic}, testBrokers(1, 2, 3), nil)
+	if a.equal(healthy) || a.equal(nil) {
+		t.Error("reports with different problems should not be equal")
+	}
+}
+
+func TestServePartitionHealth(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2, 3))
+	setTopic(source, paymentsTopic)
+
+	var health PartitionHealth
+	getJSON(t, s, "/partitions/health", &health)
+	// Without a Kafka client min.insync.replicas is unknown.
+	want := PartitionHealthCounts{UnderReplicated: 2, Offline: 1}
+	if health.PartitionHealthCounts != want {
+		t.Errorf("counts = %+v, want %+v", health.PartitionHealthCounts, want)
+	}
+
+	var status ClusterStatus
+	getJSON(t, s, "/", &status)
+	if status.Health == nil || *status.Health != want {
+		t.Errorf("cluster status health = %+v, want %+v", status.Health, want)
+	}
+}
@@ -0,0 +1,961 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// reassignmentPollInterval is how often a running reassignment job asks
+// the controller which partitions are still moving.
+const reassignmentPollInterval = 5 * time.Second
+
+// PlanRequest is the body of POST /reassignments/plan. Brokers are the
+// brokers the topics should end up on; without them every live broker is
+// used. Replicas on brokers that aren't listed are moved off.
+type PlanRequest struct {
+	Topics  []string `json:"topics"`
+	Brokers []int32  `json:"brokers"`
+}
+
+// PartitionReassignment is one partition whose replicas change. Replicas
+// lists the proposed replicas, preferred leader first.
+type PartitionReassignment struct {
+	Topic        string  `json:"topic"`
+	Partition    int32   `json:"partition"`
+	Current      []int32 `json:"current,omitempty"`
+	Replicas     []int32 `json:"replicas"`
+	Adding       []int32 `json:"adding,omitempty"`
+	Removing     []int32 `json:"removing,omitempty"`
+	LeaderChange bool    `json:"leaderChange,omitempty"`
+}
+
+// BrokerLoad counts the replicas and preferred leaders of the planned
+// topics on a broker before and after a plan.
+type BrokerLoad struct {
+	Broker         int32  `json:"broker"`
+	Rack           string `json:"rack,omitempty"`
+	ReplicasBefore int    `json:"replicasBefore"`
+	ReplicasAfter  int    `json:"replicasAfter"`
+	LeadersBefore  int    `json:"leadersBefore"`
+	LeadersAfter   int    `json:"leadersAfter"`
+}
+
+// ReassignmentPlan is a proposed reassignment. Only partitions that change
+// are listed; ReplicaMoves is how many replicas have to be copied to a new
+// broker.
+type ReassignmentPlan struct {
+	Topics       []string                `json:"topics"`
+	Brokers      []int32                 `json:"brokers"`
+	Partitions   []PartitionReassignment `json:"partitions"`
+	ReplicaMoves int                     `json:"replicaMoves"`
+	LeaderMoves  int                     `json:"leaderMoves"`
+	Load         []BrokerLoad            `json:"load"`
+}
+
+// ReassignmentRequest is the body of POST /reassignments, usually a plan
+// as returned by /reassignments/plan. ThrottleBytesPerSec limits the
+// replication traffic of the moved partitions until they are in sync;
+// zero doesn't throttle.
+type ReassignmentRequest struct {
+	Partitions          []PartitionReassignment `json:"partitions"`
+	ThrottleBytesPerSec int64                   `json:"throttleBytesPerSec"`
+}
+
+// ReassignmentProgress is reported with a reassignment job.
+type ReassignmentProgress struct {
+	Partitions int                     `json:"partitions"`
+	Completed  int                     `json:"completed"`
+	Moving     []PartitionReassignment `json:"moving,omitempty"`
+	Throttled  bool                    `json:"throttled"`
+}
+
+// OngoingReassignment is a reassignment the controller reports as in
+// progress, whoever started it.
+type OngoingReassignment struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Replicas  []int32 `json:"replicas"`
+	Adding    []int32 `json:"adding"`
+	Removing  []int32 `json:"removing"`
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// reassignmentPlanner balances the replicas of a set of partitions over
+// target brokers while moving as few replicas as possible.
+type reassignmentPlanner struct {
+	racks     map[int32]string
+	rackCount int
+	targets   []int32
+	target    map[int32]bool
+	keys      []partitionKey
+	assign    map[partitionKey][]int32
+	replicas  map[int32]int
+	leaders   map[int32]int
+}
+
+// planReassignment proposes new replica assignments for topics. It first
+// moves replicas off brokers that aren't targets, then spreads replicas
+// over racks, then evens out the replica count per broker one move at a
+// time and finally picks preferred leaders, which only reorders replicas.
+func planReassignment(topics []TopicMetadata, brokers []BrokerInfo, targets []int32) (*ReassignmentPlan, error) {
+	p := &reassignmentPlanner{
+		racks:    make(map[int32]string),
+		target:   make(map[int32]bool),
+		assign:   make(map[partitionKey][]int32),
+		replicas: make(map[int32]int),
+		leaders:  make(map[int32]int),
+	}
+
+	live := make(map[int32]bool, len(brokers))
+	for _, broker := range brokers {
+		live[broker.ID] = true
+		p.racks[broker.ID] = broker.Rack
+	}
+	if len(targets) == 0 {
+		for _, broker := range brokers {
+			targets = append(targets, broker.ID)
+		}
+	}
+	racks := make(map[string]bool)
+	for _, broker := range targets {
+		if !live[broker] {
+			return nil, fmt.Errorf("broker %d is not part of the cluster", broker)
+		}
+		if !p.target[broker] {
+			p.target[broker] = true
+			p.targets = append(p.targets, broker)
+			racks[p.racks[broker]] = true
+		}
+	}
+	slices.Sort(p.targets)
+	if !racks[""] {
+		p.rackCount = len(racks)
+	}
+
+	current := make(map[partitionKey][]int32)
+	for _, topic := range topics {
+		for _, partition := range topic.Partitions {
+			if len(partition.Replicas) > len(p.targets) {
+				return nil, fmt.Errorf("topic %s has %d replicas per partition but only %d target brokers", topic.Name, len(partition.Replicas), len(p.targets))
+			}
+			key := partitionKey{topic.Name, partition.ID}
+			p.keys = append(p.keys, key)
+			current[key] = partition.Replicas
+			p.assign[key] = slices.Clone(partition.Replicas)
+			for i, broker := range partition.Replicas {
+				if p.target[broker] {
+					p.replicas[broker]++
+					if i == 0 {
+						p.leaders[broker]++
+					}
+				}
+			}
+		}
+	}
+
+	p.evacuate()
+	p.spreadRacks()
+	p.balanceReplicas()
+	p.balanceLeaders()
+
+	return p.plan(topics, brokers, current), nil
+}
+
+// evacuate replaces replicas on brokers that aren't targets.
+func (p *reassignmentPlanner) evacuate() {
+	for _, key := range p.keys {
+		replicas := p.assign[key]
+		for i, broker := range replicas {
+			if p.target[broker] {
+				continue
+			}
+			if to, ok := p.pick(replicas, i); ok {
+				p.move(key, i, to)
+			}
+		}
+	}
+}
+
+// spreadRacks moves replicas that share a rack with another replica of the
+// same partition to an unused rack, when the cluster has enough racks.
+func (p *reassignmentPlanner) spreadRacks() {
+	if p.rackCount == 0 {
+		return
+	}
+	for _, key := range p.keys {
+		replicas := p.assign[key]
+		for i := len(replicas) - 1; i > 0; i-- {
+			if p.distinctRacks(replicas) >= min(len(replicas), p.rackCount) {
+				break
+			}
+			if !p.rackShared(replicas, i) {
+				continue
+			}
+			if to, ok := p.pick(replicas, i); ok && !p.rackUsed(replicas, i, p.racks[to]) {
+				p.move(key, i, to)
+			}
+		}
+	}
+}
+
+// balanceReplicas moves one replica at a time from the most to the least
+// loaded broker until no two targets differ by more than one replica.
+func (p *reassignmentPlanner) balanceReplicas() {
+	stuck := make(map[int32]bool)
+	for n := 0; n < len(p.keys)*len(p.targets); n++ {
+		from, to := p.mostLoaded(stuck), p.leastLoaded()
+		if from < 0 || p.replicas[from]-p.replicas[to] <= 1 {
+			return
+		}
+		if !p.moveOne(from, to) {
+			stuck[from] = true
+		}
+	}
+}
+
+// moveOne moves a replica from one broker to another without breaking rack
+// spread, preferring follower replicas so leadership moves less.
+func (p *reassignmentPlanner) moveOne(from, to int32) bool {
+	for _, followersOnly := range []bool{true, false} {
+		for _, key := range p.keys {
+			replicas := p.assign[key]
+			i := slices.Index(replicas, from)
+			if i < 0 || (followersOnly && i == 0) || slices.Contains(replicas, to) {
+				continue
+			}
+			if p.rackCount > 0 && p.racks[from] != p.racks[to] && p.rackUsed(replicas, i, p.racks[to]) {
+				continue
+			}
+			p.move(key, i, to)
+			return true
+		}
+	}
+	return false
+}
+
+// balanceLeaders makes the replica with the fewest preferred leaderships
+// the leader of each partition while that evens out leadership.
+func (p *reassignmentPlanner) balanceLeaders() {
+	for changed := true; changed; {
+		changed = false
+		for _, key := range p.keys {
+			replicas := p.assign[key]
+			leader, best := replicas[0], 0
+			for i, broker := range replicas[1:] {
+				if p.leaders[broker] < p.leaders[replicas[best]] {
+					best = i + 1
+				}
+			}
+			if best == 0 || p.leaders[leader]-p.leaders[replicas[best]] <= 1 {
+				continue
+			}
+			p.leaders[leader]--
+			p.leaders[replicas[best]]++
+			replicas[0], replicas[best] = replicas[best], replicas[0]
+			changed = true
+		}
+	}
+}
+
+// pick returns the least loaded target that can replace replicas[i],
+// preferring brokers on racks the other replicas don't use.
+func (p *reassignmentPlanner) pick(replicas []int32, i int) (int32, bool) {
+	best := int32(-1)
+	bestFresh := false
+	for _, broker := range p.targets {
+		if slices.Contains(replicas, broker) {
+			continue
+		}
+		fresh := p.rackCount > 0 && !p.rackUsed(replicas, i, p.racks[broker])
+		switch {
+		case best < 0,
+			fresh && !bestFresh,
+			fresh == bestFresh && p.replicas[broker] < p.replicas[best]:
+			best, bestFresh = broker, fresh
+		}
+	}
+	return best, best >= 0
+}
+
+func (p *reassignmentPlanner) move(key partitionKey, i int, to int32) {
+	replicas := p.assign[key]
+	from := replicas[i]
+	if p.target[from] {
+		p.replicas[from]--
+		if i == 0 {
+			p.leaders[from]--
+		}
+	}
+	p.replicas[to]++
+	if i == 0 {
+		p.leaders[to]++
+	}
+	replicas[i] = to
+}
+
+func (p *reassignmentPlanner) mostLoaded(skip map[int32]bool) int32 {
+	most := int32(-1)
+	for _, broker := range p.targets {
+		if !skip[broker] && (most < 0 || p.replicas[broker] > p.replicas[most]) {
+			most = broker
+		}
+	}
+	return most
+}
+
+func (p *reassignmentPlanner) leastLoaded() int32 {
+	least := p.targets[0]
+	for _, broker := range p.targets[1:] {
+		if p.replicas[broker] < p.replicas[least] {
+			least = broker
+		}
+	}
+	return least
+}
+
+// rackUsed reports whether a replica other than replicas[i] is on rack.
+func (p *reassignmentPlanner) rackUsed(replicas []int32, i int, rack string) bool {
+	for j, broker := range replicas {
+		if j != i && p.racks[broker] == rack {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *reassignmentPlanner) rackShared(replicas []int32, i int) bool {
+	return p.rackUsed(replicas, i, p.racks[replicas[i]])
+}
+
+func (p *reassignmentPlanner) distinctRacks(replicas []int32) int {
+	racks := make(map[string]bool, len(replicas))
+	for _, broker := range replicas {
+		racks[p.racks[broker]] = true
+	}
+	return len(racks)
+}
+
+func (p *reassignmentPlanner) plan(topics []TopicMetadata, brokers []BrokerInfo, current map[partitionKey][]int32) *ReassignmentPlan {
+	plan := &ReassignmentPlan{Brokers: p.targets, Partitions: []PartitionReassignment{}}
+	for _, topic := range topics {
+		plan.Topics = append(plan.Topics, topic.Name)
+	}
+
+	loads := make(map[int32]*BrokerLoad, len(brokers))
+	for _, broker := range brokers {
+		loads[broker.ID] = &BrokerLoad{Broker: broker.ID, Rack: broker.Rack}
+	}
+	count := func(replicas []int32, before bool) {
+		for i, broker := range replicas {
+			load, ok := loads[broker]
+			if !ok {
+				load = &BrokerLoad{Broker: broker}
+				loads[broker] = load
+			}
+			if before {
+				load.ReplicasBefore++
+				if i == 0 {
+					load.LeadersBefore++
+				}
+			} else {
+				load.ReplicasAfter++
+				if i == 0 {
+					load.LeadersAfter++
+				}
+			}
+		}
+	}
+
+	for _, key := range p.keys {
+		before, after := current[key], p.assign[key]
+		count(before, true)
+		count(after, false)
+		if slices.Equal(before, after) {
+			continue
+		}
+
+		change := PartitionReassignment{
+			Topic:        key.topic,
+			Partition:    key.partition,
+			Current:      before,
+			Replicas:     after,
+			Adding:       missingFrom(after, before),
+			Removing:     missingFrom(before, after),
+			LeaderChange: before[0] != after[0],
+		}
+		plan.ReplicaMoves += len(change.Adding)
+		if change.LeaderChange {
+			plan.LeaderMoves++
+		}
+		plan.Partitions = append(plan.Partitions, change)
+	}
+
+	for _, load := range loads {
+		plan.Load = append(plan.Load, *load)
+	}
+	sort.Slice(plan.Load, func(i, j int) bool { return plan.Load[i].Broker < plan.Load[j].Broker })
+	return plan
+}
+
+// missingFrom returns the brokers of a that aren't in b.
+func missingFrom(a, b []int32) []int32 {
+	var missing []int32
+	for _, broker := range a {
+		if !slices.Contains(b, broker) {
+			missing = append(missing, broker)
+		}
+	}
+	return missing
+}
+
+func (s *Server) serveReassignmentPlan(w http.ResponseWriter, r *http.Request) {
+	var req PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	topics := req.Topics
+	if len(topics) == 0 {
+		var err error
+		if topics, err = s.source.ListTopics(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list topics: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	metadata, err := s.source.DescribeTopics(topics)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe topics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	brokers, err := s.source.ListBrokers()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list brokers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	plan, err := planReassignment(metadata, brokers, req.Brokers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// startReassignment submits a reassignment to the controller and starts a
+// job that follows it. Cancelling the job cancels the partitions that are
+// still moving. Throttles are removed once nothing is moving any more.
+func (s *Server) startReassignment(w http.ResponseWriter, r *http.Request) {
+	var req ReassignmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Partitions) == 0 {
+		http.Error(w, "No partitions to reassign", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := s.validateReassignment(req.Partitions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	var throttle *reassignmentThrottle
+	if req.ThrottleBytesPerSec > 0 {
+		if throttle, err = setReassignmentThrottle(admin, changes, req.ThrottleBytesPerSec); err != nil {
+			throttle.clear(admin)
+			http.Error(w, fmt.Sprintf("Failed to set replication throttle: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	target := make(map[partitionKey][]int32, len(changes))
+	for _, change := range changes {
+		target[partitionKey{change.Topic, change.Partition}] = change.Replicas
+	}
+	if err := alterReassignments(s.kafkaConn, target); err != nil {
+		throttle.clear(admin)
+		http.Error(w, fmt.Sprintf("Failed to start reassignment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	job := s.jobs.Start("reassignment", func(ctx context.Context, progress *JobProgress) (interface{}, error) {
+		return s.followReassignment(ctx, changes, throttle, progress)
+	}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// validateReassignment checks the requested replicas against the cluster
+// and fills in each partition's current replicas.
+func (s *Server) validateReassignment(requested []PartitionReassignment) ([]PartitionReassignment, error) {
+	brokers, err := s.source.ListBrokers()
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[int32]bool, len(brokers))
+	for _, broker := range brokers {
+		live[broker.ID] = true
+	}
+
+	var topics []string
+	for _, change := range requested {
+		if !slices.Contains(topics, change.Topic) {
+			topics = append(topics, change.Topic)
+		}
+	}
+	metadata, err := s.source.DescribeTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[partitionKey][]int32)
+	for _, topic := range metadata {
+		for _, partition := range topic.Partitions {
+			current[partitionKey{topic.Name, partition.ID}] = partition.Replicas
+		}
+	}
+
+	seen := make(map[partitionKey]bool, len(requested))
+	changes := make([]PartitionReassignment, 0, len(requested))
+	for _, change := range requested {
+		key := partitionKey{change.Topic, change.Partition}
+		replicas, ok := current[key]
+		if !ok {
+			return nil, fmt.Errorf("partition %s-%d does not exist", change.Topic, change.Partition)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("partition %s-%d is listed twice", change.Topic, change.Partition)
+		}
+		seen[key] = true
+		if len(change.Replicas) == 0 {
+			return nil, fmt.Errorf("partition %s-%d has no replicas", change.Topic, change.Partition)
+		}
+		for i, broker := range change.Replicas {
+			if !live[broker] {
+				return nil, fmt.Errorf("partition %s-%d: broker %d is not part of the cluster", change.Topic, change.Partition, broker)
+			}
+			if slices.Contains(change.Replicas[:i], broker) {
+				return nil, fmt.Errorf("partition %s-%d lists broker %d twice", change.Topic, change.Partition, broker)
+			}
+		}
+
+		change.Current = replicas
+		change.Adding = missingFrom(change.Replicas, replicas)
+		change.Removing = missingFrom(replicas, change.Replicas)
+		change.LeaderChange = replicas[0] != change.Replicas[0]
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// followReassignment polls the controller until none of changes is moving
+// any more, or ctx is cancelled, in which case the remaining partitions are
+// cancelled. The throttle, if any, is cleared at the end.
+func (s *Server) followReassignment(ctx context.Context, changes []PartitionReassignment, throttle *reassignmentThrottle, progress *JobProgress) (*ReassignmentProgress, error) {
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	defer throttle.clear(admin)
+
+	status := &ReassignmentProgress{Partitions: len(changes), Throttled: throttle != nil}
+	progress.SetTotal(int64(len(changes)))
+
+	ticker := time.NewTicker(reassignmentPollInterval)
+	defer ticker.Stop()
+	for {
+		ongoing, err := listReassignments(admin, changes)
+		if err != nil {
+			log.Printf("Failed to list partition reassignments: %v", err)
+		} else {
+			status.Moving = status.Moving[:0]
+			for _, change := range changes {
+				if _, moving := ongoing[partitionKey{change.Topic, change.Partition}]; moving {
+					status.Moving = append(status.Moving, change)
+				}
+			}
+			status.Completed = len(changes) - len(status.Moving)
+			progress.Set(int64(status.Completed))
+			if len(status.Moving) == 0 {
+				return status, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			cancel := make(map[partitionKey][]int32, len(status.Moving))
+			for _, change := range status.Moving {
+				cancel[partitionKey{change.Topic, change.Partition}] = nil
+			}
+			if err := alterReassignments(s.kafkaConn, cancel); err != nil {
+				log.Printf("Failed to cancel partition reassignment: %v", err)
+			}
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// listReassignments returns the ongoing reassignments of the partitions
+// in changes.
+func listReassignments(admin sarama.ClusterAdmin, changes []PartitionReassignment) (map[partitionKey]*sarama.PartitionReplicaReassignmentsStatus, error) {
+	partitions := make(map[string][]int32)
+	for _, change := range changes {
+		partitions[change.Topic] = append(partitions[change.Topic], change.Partition)
+	}
+
+	ongoing := make(map[partitionKey]*sarama.PartitionReplicaReassignmentsStatus)
+	for topic, ids := range partitions {
+		statuses, err := admin.ListPartitionReassignments(topic, ids)
+		if err != nil {
+			return nil, err
+		}
+		for partition, status := range statuses[topic] {
+			ongoing[partitionKey{topic, partition}] = status
+		}
+	}
+	return ongoing, nil
+}
+
+// alterReassignments submits target replicas, or nil to cancel, for exactly
+// the partitions in target. The request goes straight to the controller,
+// since the admin client's AlterPartitionReassignments resubmits every
+// partition of a topic. Like the admin client it retries with a refreshed
+// controller when the controller has moved.
+func alterReassignments(client sarama.Client, target map[partitionKey][]int32) error {
+	request := &sarama.AlterPartitionReassignmentsRequest{TimeoutMs: 60000}
+	for key, replicas := range target {
+		request.AddBlock(key.topic, key.partition, replicas)
+	}
+
+	retry := client.Config().Admin.Retry
+	controller, err := client.Controller()
+	for attempt := 0; ; attempt++ {
+		var response *sarama.AlterPartitionReassignmentsResponse
+		if err == nil {
+			response, err = controller.AlterPartitionReassignments(request)
+		}
+		if err == nil && response.ErrorCode != sarama.ErrNoError {
+			err = response.ErrorCode
+		}
+		if err == nil {
+			return reassignmentErrors(response)
+		}
+		if attempt >= retry.Max || !isControllerMoved(err) {
+			return err
+		}
+		time.Sleep(retry.Backoff)
+		controller, err = client.RefreshController()
+	}
+}
+
+func isControllerMoved(err error) bool {
+	return errors.Is(err, sarama.ErrNotController) || errors.Is(err, io.EOF)
+}
+
+// reassignmentErrors joins the per-partition errors of response.
+func reassignmentErrors(response *sarama.AlterPartitionReassignmentsResponse) error {
+	var errs []string
+	for topic, partitions := range response.Errors {
+		for partition, block := range partitions {
+			kerr, message, ok := reassignmentError(block)
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Sprintf("%s-%d: unreadable result", topic, partition))
+			case kerr == sarama.ErrNoError:
+			case message != "":
+				errs = append(errs, fmt.Sprintf("%s-%d: %v: %s", topic, partition, kerr, message))
+			default:
+				errs = append(errs, fmt.Sprintf("%s-%d: %v", topic, partition, kerr))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reassignmentError reads the error of a partition in an
+// AlterPartitionReassignments response, which sarama doesn't export. ok is
+// false when the block doesn't have the fields it is expected to have.
+func reassignmentError(block interface{}) (kerr sarama.KError, message string, ok bool) {
+	value := reflect.ValueOf(block)
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return sarama.ErrNoError, "", true
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return sarama.ErrNoError, "", false
+	}
+
+	code := value.FieldByName("errorCode")
+	if !code.IsValid() || code.Kind() != reflect.Int16 {
+		return sarama.ErrNoError, "", false
+	}
+	if text := value.FieldByName("errorMessage"); text.IsValid() && text.Kind() == reflect.Pointer &&
+		!text.IsNil() && text.Elem().Kind() == reflect.String {
+		message = text.Elem().String()
+	}
+	return sarama.KError(code.Int()), message, true
+}
+
+// Replication throttle configs.
+const (
+	leaderThrottledRate       = "leader.replication.throttled.rate"
+	followerThrottledRate     = "follower.replication.throttled.rate"
+	leaderThrottledReplicas   = "leader.replication.throttled.replicas"
+	followerThrottledReplicas = "follower.replication.throttled.replicas"
+)
+
+// reassignmentThrottle remembers what setReassignmentThrottle changed, so
+// clear can put back the throttles that were configured before and leave
+// those added by anybody else in the meantime.
+type reassignmentThrottle struct {
+	// rates holds each broker's previous rates; a missing rate wasn't set.
+	rates map[int32]map[string]string
+	// replicas holds the entries added to each topic's replica lists.
+	replicas map[string]map[string][]string
+}
+
+// setReassignmentThrottle limits replication of the moving partitions: the
+// current replicas are throttled as leaders and the new replicas as
+// followers, on every broker involved. Replicas are added to the topics'
+// existing throttled replica lists. The returned throttle records what was
+// changed, also when it fails part way.
+func setReassignmentThrottle(admin sarama.ClusterAdmin, changes []PartitionReassignment, bytesPerSec int64) (*reassignmentThrottle, error) {
+	wanted := make(map[string]map[string][]string)
+	brokers := make(map[int32]bool)
+	add := func(config, topic string, partition, broker int32) {
+		if wanted[topic] == nil {
+			wanted[topic] = make(map[string][]string)
+		}
+		wanted[topic][config] = append(wanted[topic][config], fmt.Sprintf("%d:%d", partition, broker))
+		brokers[broker] = true
+	}
+	for _, change := range changes {
+		for _, broker := range change.Current {
+			add(leaderThrottledReplicas, change.Topic, change.Partition, broker)
+		}
+		for _, broker := range change.Adding {
+			add(followerThrottledReplicas, change.Topic, change.Partition, broker)
+		}
+	}
+
+	throttle := &reassignmentThrottle{
+		rates:    make(map[int32]map[string]string),
+		replicas: make(map[string]map[string][]string),
+	}
+	rate := strconv.FormatInt(bytesPerSec, 10)
+	for broker := range brokers {
+		name := strconv.Itoa(int(broker))
+		previous, err := describeConfigValues(admin, sarama.BrokerResource, name, sarama.SourceDynamicBroker, leaderThrottledRate, followerThrottledRate)
+		if err != nil {
+			return throttle, fmt.Errorf("broker %d: %w", broker, err)
+		}
+		err = admin.IncrementalAlterConfig(sarama.BrokerResource, name, map[string]sarama.IncrementalAlterConfigsEntry{
+			leaderThrottledRate:   {Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &rate},
+			followerThrottledRate: {Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &rate},
+		}, false)
+		if err != nil {
+			return throttle, fmt.Errorf("broker %d: %w", broker, err)
+		}
+		throttle.rates[broker] = previous
+	}
+
+	for topic, configs := range wanted {
+		current, err := describeConfigValues(admin, sarama.TopicResource, topic, sarama.SourceTopic, leaderThrottledReplicas, followerThrottledReplicas)
+		if err != nil {
+			return throttle, fmt.Errorf("topic %s: %w", topic, err)
+		}
+		entries := make(map[string]sarama.IncrementalAlterConfigsEntry)
+		added := make(map[string][]string)
+		for config, replicas := range configs {
+			list := splitThrottledReplicas(current[config])
+			if slices.Contains(list, "*") {
+				continue
+			}
+			for _, replica := range replicas {
+				if !slices.Contains(list, replica) {
+					list = append(list, replica)
+					added[config] = append(added[config], replica)
+				}
+			}
+			if len(added[config]) > 0 {
+				value := strings.Join(list, ",")
+				entries[config] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &value}
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		if err := admin.IncrementalAlterConfig(sarama.TopicResource, topic, entries, false); err != nil {
+			return throttle, fmt.Errorf("topic %s: %w", topic, err)
+		}
+		throttle.replicas[topic] = added
+	}
+	return throttle, nil
+}
+
+// clear takes the replicas it added back out of the topics' current
+// throttled replica lists and restores the brokers' previous rates. Failures
+// are logged, since there is nobody left to report them to.
+func (t *reassignmentThrottle) clear(admin sarama.ClusterAdmin) {
+	if t == nil {
+		return
+	}
+
+	for topic, added := range t.replicas {
+		current, err := describeConfigValues(admin, sarama.TopicResource, topic, sarama.SourceTopic, leaderThrottledReplicas, followerThrottledReplicas)
+		if err != nil {
+			log.Printf("Failed to remove replication throttle from topic %s: %v", topic, err)
+			continue
+		}
+		entries := make(map[string]sarama.IncrementalAlterConfigsEntry)
+		for config, replicas := range added {
+			var list []string
+			for _, replica := range splitThrottledReplicas(current[config]) {
+				if !slices.Contains(replicas, replica) {
+					list = append(list, replica)
+				}
+			}
+			entries[config] = restoreConfigEntry(strings.Join(list, ","))
+		}
+		if err := admin.IncrementalAlterConfig(sarama.TopicResource, topic, entries, false); err != nil {
+			log.Printf("Failed to remove replication throttle from topic %s: %v", topic, err)
+		}
+	}
+
+	for broker, previous := range t.rates {
+		err := admin.IncrementalAlterConfig(sarama.BrokerResource, strconv.Itoa(int(broker)), map[string]sarama.IncrementalAlterConfigsEntry{
+			leaderThrottledRate:   restoreConfigEntry(previous[leaderThrottledRate]),
+			followerThrottledRate: restoreConfigEntry(previous[followerThrottledRate]),
+		}, false)
+		if err != nil {
+			log.Printf("Failed to restore replication throttle of broker %d: %v", broker, err)
+		}
+	}
+}
+
+// describeConfigValues returns the configs of a resource that are set at
+// the level of source, such as a topic override or a per-broker dynamic
+// config. Configs inherited from elsewhere are left out.
+func describeConfigValues(admin sarama.ClusterAdmin, resourceType sarama.ConfigResourceType, name string, source sarama.ConfigSource, configs ...string) (map[string]string, error) {
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{Type: resourceType, Name: name, ConfigNames: configs})
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Source == source && slices.Contains(configs, entry.Name) {
+			values[entry.Name] = entry.Value
+		}
+	}
+	return values, nil
+}
+
+// restoreConfigEntry sets a config back to value, or removes it when value
+// is empty.
+func restoreConfigEntry(value string) sarama.IncrementalAlterConfigsEntry {
+	if value == "" {
+		return sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationDelete}
+	}
+	return sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &value}
+}
+
+func splitThrottledReplicas(value string) []string {
+	var replicas []string
+	for _, replica := range strings.Split(value, ",") {
+		if replica = strings.TrimSpace(replica); replica != "" {
+			replicas = append(replicas, replica)
+		}
+	}
+	return replicas
+}
+
+// serveReassignments lists every reassignment in progress on the cluster,
+// including those started with other tools.
+func (s *Server) serveReassignments(w http.ResponseWriter, r *http.Request) {
+	topics, err := s.source.ListTopics()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list topics: %v", err), http.StatusInternalServerError)
+		return
+	}
+	metadata, err := s.source.DescribeTopics(topics)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe topics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	ongoing := []OngoingReassignment{}
+	for _, topic := range metadata {
+		ids := make([]int32, len(topic.Partitions))
+		for i, partition := range topic.Partitions {
+			ids[i] = partition.ID
+		}
+		statuses, err := admin.ListPartitionReassignments(topic.Name, ids)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list reassignments of topic %s: %v", topic.Name, err), http.StatusInternalServerError)
+			return
+		}
+		for partition, status := range statuses[topic.Name] {
+			ongoing = append(ongoing, OngoingReassignment{
+				Topic:     topic.Name,
+				Partition: partition,
+				Replicas:  status.Replicas,
+				Adding:    status.AddingReplicas,
+				Removing:  status.RemovingReplicas,
+			})
+		}
+	}
+	sort.Slice(ongoing, func(i, j int) bool {
+		if ongoing[i].Topic != ongoing[j].Topic {
+			return ongoing[i].Topic < ongoing[j].Topic
+		}
+		return ongoing[i].Partition < ongoing[j].Partition
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ongoing)
+}
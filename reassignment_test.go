@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// partitionsOn builds a topic whose partitions have the given replicas.
+func partitionsOn(name string, replicas ...[]int32) TopicMetadata {
+	topic := TopicMetadata{Name: name}
+	for i, r := range replicas {
+		topic.Partitions = append(topic.Partitions, PartitionMetadata{ID: int32(i), Leader: r[0], Replicas: r, ISR: r})
+	}
+	return topic
+}
+
+func rackBrokers(racks map[int32]string) []BrokerInfo {
+	var brokers []BrokerInfo
+	for id, rack := range racks {
+		brokers = append(brokers, BrokerInfo{ID: id, Hostname: "localhost", Port: 9092 + id, Rack: rack})
+	}
+	slices.SortFunc(brokers, func(a, b BrokerInfo) int { return int(a.ID - b.ID) })
+	return brokers
+}
+
+// assignment applies plan to topics.
+func assignment(topics []TopicMetadata, plan *ReassignmentPlan) map[partitionKey][]int32 {
+	assign := make(map[partitionKey][]int32)
+	for _, topic := range topics {
+		for _, partition := range topic.Partitions {
+			assign[partitionKey{topic.Name, partition.ID}] = partition.Replicas
+		}
+	}
+	for _, change := range plan.Partitions {
+		assign[partitionKey{change.Topic, change.Partition}] = change.Replicas
+	}
+	return assign
+}
+
+func checkAssignment(t *testing.T, assign map[partitionKey][]int32, replicationFactor int) (replicas, leaders map[int32]int) {
+	t.Helper()
+	replicas, leaders = make(map[int32]int), make(map[int32]int)
+	for key, brokers := range assign {
+		if len(brokers) != replicationFactor {
+			t.Errorf("%v has replicas %v, want %d", key, brokers, replicationFactor)
+		}
+		for i, broker := range brokers {
+			if slices.Contains(brokers[:i], broker) {
+				t.Errorf("%v has broker %d twice: %v", key, broker, brokers)
+			}
+			replicas[broker]++
+		}
+		leaders[brokers[0]]++
+	}
+	return replicas, leaders
+}
+
+func TestPlanReassignmentBalancedCluster(t *testing.T) {
+	topics := []TopicMetadata{partitionsOn("orders", []int32{1, 2}, []int32{2, 3}, []int32{3, 1})}
+	plan, err := planReassignment(topics, testBrokers(1, 2, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Partitions) != 0 || plan.ReplicaMoves != 0 || plan.LeaderMoves != 0 {
+		t.Errorf("plan for a balanced cluster = %+v, want no changes", plan)
+	}
+	if !slices.Equal(plan.Brokers, []int32{1, 2, 3}) || len(plan.Load) != 3 {
+		t.Errorf("brokers = %v, load = %+v", plan.Brokers, plan.Load)
+	}
+}
+
+func TestPlanReassignmentNewBroker(t *testing.T) {
+	topics := []TopicMetadata{partitionsOn("orders",
+		[]int32{1, 2}, []int32{2, 1}, []int32{1, 2}, []int32{2, 1}, []int32{1, 2}, []int32{2, 1})}
+	plan, err := planReassignment(topics, testBrokers(1, 2, 3), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replicas, leaders := checkAssignment(t, assignment(topics, plan), 2)
+	for _, broker := range []int32{1, 2, 3} {
+		if replicas[broker] != 4 || leaders[broker] != 2 {
+			t.Errorf("broker %d has %d replicas and %d leaders, want 4 and 2", broker, replicas[broker], leaders[broker])
+		}
+	}
+	// Broker 3 needs four replicas, each of which is one move.
+	if plan.ReplicaMoves != 4 {
+		t.Errorf("ReplicaMoves = %d, want 4", plan.ReplicaMoves)
+	}
+	for _, change := range plan.Partitions {
+		if !slices.Equal(change.Adding, []int32{3}) || len(change.Removing) != 1 {
+			t.Errorf("%s-%d adds %v and removes %v", change.Topic, change.Partition, change.Adding, change.Removing)
+		}
+		if change.LeaderChange != (change.Current[0] != change.Replicas[0]) {
+			t.Errorf("%s-%d: LeaderChange = %v for %v -> %v", change.Topic, change.Partition, change.LeaderChange, change.Current, change.Replicas)
+		}
+	}
+	for _, load := range plan.Load {
+		if load.Broker == 3 && (load.ReplicasBefore != 0 || load.ReplicasAfter != 4) {
+			t.Errorf("load of broker 3 = %+v", load)
+		}
+	}
+}
+
+func TestPlanReassignmentEvacuate(t *testing.T) {
+	topics := []TopicMetadata{partitionsOn("orders", []int32{4, 1}, []int32{2, 4}, []int32{3, 4}, []int32{1, 2})}
+	plan, err := planReassignment(topics, testBrokers(1, 2, 3, 4), []int32{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas, _ := checkAssignment(t, assignment(topics, plan), 2)
+	if replicas[4] != 0 {
+		t.Errorf("broker 4 keeps %d replicas", replicas[4])
+	}
+	for _, broker := range []int32{1, 2, 3} {
+		if replicas[broker] < 2 || replicas[broker] > 3 {
+			t.Errorf("broker %d has %d replicas, want 2 or 3", broker, replicas[broker])
+		}
+	}
+	if plan.ReplicaMoves != 3 {
+		t.Errorf("ReplicaMoves = %d, want 3", plan.ReplicaMoves)
+	}
+}
+
+func TestPlanReassignmentSpreadsRacks(t *testing.T) {
+	brokers := rackBrokers(map[int32]string{1: "a", 2: "a", 3: "b", 4: "b"})
+	topics := []TopicMetadata{partitionsOn("orders", []int32{1, 2}, []int32{2, 1}, []int32{3, 4}, []int32{4, 3})}
+	plan, err := planReassignment(topics, brokers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	racks := map[int32]string{1: "a", 2: "a", 3: "b", 4: "b"}
+	assign := assignment(topics, plan)
+	replicas, _ := checkAssignment(t, assign, 2)
+	for key, brokers := range assign {
+		if racks[brokers[0]] == racks[brokers[1]] {
+			t.Errorf("%v has both replicas on rack %s: %v", key, racks[brokers[0]], brokers)
+		}
+	}
+	for broker, n := range replicas {
+		if n != 2 {
+			t.Errorf("broker %d has %d replicas, want 2", broker, n)
+		}
+	}
+}
+
+func TestPlanReassignmentErrors(t *testing.T) {
+	topics := []TopicMetadata{partitionsOn("orders", []int32{1, 2, 3})}
+	for _, tc := range []struct {
+		targets []int32
+		want    string
+	}{
+		{[]int32{1, 5}, "broker 5 is not part of the cluster"},
+		{[]int32{1, 2}, "topic orders has 3 replicas per partition but only 2 target brokers"},
+	} {
+		if _, err := planReassignment(topics, testBrokers(1, 2, 3), tc.targets); err == nil || err.Error() != tc.want {
+			t.Errorf("targets %v: err = %v, want %q", tc.targets, err, tc.want)
+		}
+	}
+}
+
+func TestServeReassignmentPlan(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2, 3))
+	setTopic(source, partitionsOn("orders", []int32{1, 2}, []int32{2, 1}, []int32{1, 2}))
+
+	rec := postJSON(t, s, "/reassignments/plan", `{"topics": ["orders"], "brokers": [2, 3]}`)
+	var plan ReassignmentPlan
+	if err := json.NewDecoder(rec.Body).Decode(&plan); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("status %d, %v: %s", rec.Code, err, rec.Body.String())
+	}
+	replicas, _ := checkAssignment(t, assignment([]TopicMetadata{partitionsOn("orders", []int32{1, 2}, []int32{2, 1}, []int32{1, 2})}, &plan), 2)
+	if replicas[1] != 0 || replicas[2] != 3 || replicas[3] != 3 {
+		t.Errorf("replicas per broker = %v, want none on broker 1", replicas)
+	}
+
+	if rec := postJSON(t, s, "/reassignments/plan", `{"topics": ["orders"], "brokers": [7]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("plan onto an unknown broker: status %d, want 400", rec.Code)
+	}
+}
+
+func TestValidateReassignment(t *testing.T) {
+	s, source := newFakeServer(t)
+	source.SetBrokers(testBrokers(1, 2, 3))
+	setTopic(source, partitionsOn("orders", []int32{1, 2}, []int32{2, 3}))
+
+	changes, err := s.validateReassignment([]PartitionReassignment{{Topic: "orders", Partition: 0, Replicas: []int32{3, 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := changes[0]
+	if !slices.Equal(change.Current, []int32{1, 2}) || !slices.Equal(change.Adding, []int32{3}) ||
+		!slices.Equal(change.Removing, []int32{1}) || !change.LeaderChange {
+		t.Errorf("change = %+v", change)
+	}
+
+	for _, tc := range []struct {
+		changes []PartitionReassignment
+		want    string
+	}{
+		{[]PartitionReassignment{{Topic: "orders", Partition: 5, Replicas: []int32{1}}}, "partition orders-5 does not exist"},
+		{[]PartitionReassignment{{Topic: "orders", Partition: 0, Replicas: []int32{1}}, {Topic: "orders", Partition: 0, Replicas: []int32{2}}}, "partition orders-0 is listed twice"},
+		{[]PartitionReassignment{{Topic: "orders", Partition: 0}}, "partition orders-0 has no replicas"},
+		{[]PartitionReassignment{{Topic: "orders", Partition: 0, Replicas: []int32{1, 9}}}, "partition orders-0: broker 9 is not part of the cluster"},
+		{[]PartitionReassignment{{Topic: "orders", Partition: 0, Replicas: []int32{1, 1}}}, "partition orders-0 lists broker 1 twice"},
+	} {
+		if _, err := s.validateReassignment(tc.changes); err == nil || err.Error() != tc.want {
+			t.Errorf("err = %v, want %q", err, tc.want)
+		}
+	}
+}
+
+func TestReassignmentErrors(t *testing.T) {
+	response := &sarama.AlterPartitionReassignmentsResponse{}
+	if err := reassignmentErrors(response); err != nil {
+		t.Errorf("empty response: %v", err)
+	}
+
+	message := "replica 9 is not available"
+	response.AddError("orders", 1, sarama.ErrNoError, nil)
+	response.AddError("orders", 2, sarama.ErrNoReassignmentInProgress, nil)
+	response.AddError("orders", 0, sarama.ErrReplicaNotAvailable, &message)
+	err := reassignmentErrors(response)
+	want := "orders-0: " + sarama.ErrReplicaNotAvailable.Error() + ": replica 9 is not available; orders-2: " + sarama.ErrNoReassignmentInProgress.Error()
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+
+	if _, _, ok := reassignmentError(struct{ code int }{}); ok {
+		t.Error("a block without an error code was read")
+	}
+	if kerr, _, ok := reassignmentError((*struct{ errorCode int16 })(nil)); !ok || kerr != sarama.ErrNoError {
+		t.Error("a nil block should have no error")
+	}
+}
+
+func TestAlterReassignmentsRetriesOnControllerMove(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	message := "replica 9 is not available"
+	failed := &sarama.AlterPartitionReassignmentsResponse{Version: 0}
+	failed.AddError("orders", 0, sarama.ErrReplicaNotAvailable, &message)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()),
+		"AlterPartitionReassignmentsRequest": sarama.NewMockSequence(
+			sarama.NewMockWrapper(&sarama.AlterPartitionReassignmentsResponse{ErrorCode: sarama.ErrNotController}),
+			sarama.NewMockWrapper(failed),
+		),
+	})
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_4_0_0
+	config.Admin.Retry.Backoff = time.Millisecond
+	config.Net.ReadTimeout = 5 * time.Second
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = alterReassignments(client, map[partitionKey][]int32{{"orders", 0}: {1, 9}})
+	if err == nil || !strings.Contains(err.Error(), "orders-0: ") || !strings.Contains(err.Error(), message) {
+		t.Errorf("err = %v, want the partition error from the second attempt", err)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Rebalance event types.
+const (
+	RebalanceStateChange = "state-change"
+	RebalanceStarted     = "rebalance-started"
+	RebalanceCompleted   = "rebalance-completed"
+	RebalanceGeneration  = "generation-bump"
+	RebalanceMemberJoin  = "member-joined"
+	RebalanceMemberLeave = "member-left"
+)
+
+const (
+	// maxGroupEvents and maxRecentEvents bound the per-group timelines and
+	// the feed shared by all groups.
+	maxGroupEvents  = 200
+	maxRecentEvents = 5000
+	// rebalanceWindow is how long completed rebalances are counted for.
+	rebalanceWindow = 24 * time.Hour
+)
+
+// RebalanceEvent is one entry of a group's rebalance timeline. Seq orders
+// events across all groups. Generation is inferred by counting completed
+// rebalances since the dashboard started watching the group, since
+// DescribeGroups doesn't report it. A completed rebalance carries how long
+// the group was seen in PreparingRebalance and CompletingRebalance; both are
+// 0 when the whole rebalance happened between two polls.
+type RebalanceEvent struct {
+	Seq               int64     `json:"seq"`
+	Time              time.Time `json:"time"`
+	Group             string    `json:"group"`
+	Type              string    `json:"type"`
+	From              string    `json:"from,omitempty"`
+	To                string    `json:"to,omitempty"`
+	MemberID          string    `json:"memberId,omitempty"`
+	ClientID          string    `json:"clientId,omitempty"`
+	Host              string    `json:"host,omitempty"`
+	Generation        int32     `json:"generation"`
+	PreparingSeconds  float64   `json:"preparingSeconds,omitempty"`
+	CompletingSeconds float64   `json:"completingSeconds,omitempty"`
+	MembersBefore     int       `json:"membersBefore,omitempty"`
+	MembersAfter      int       `json:"membersAfter,omitempty"`
+}
+
+// RebalanceStats is the rebalance frequency of a group.
+type RebalanceStats struct {
+	Generation    int32      `json:"generation"`
+	LastHour      int        `json:"lastHour"`
+	LastDay       int        `json:"lastDay"`
+	LastRebalance *time.Time `json:"lastRebalance,omitempty"`
+	WatchedSince  time.Time  `json:"watchedSince"`
+}
+
+type GroupRebalances struct {
+	Group string `json:"group"`
+	State string `json:"state"`
+	RebalanceStats
+	Events []RebalanceEvent `json:"events"`
+}
+
+type rebalanceMember struct {
+	clientID string
+	host     string
+}
+
+// groupTimeline is what the tracker knows about one group.
+type groupTimeline struct {
+	state        string
+	stateSince   time.Time
+	members      map[string]rebalanceMember
+	generation   int32
+	watchedSince time.Time
+	lastSeen     time.Time
+
+	// Set while the group is rebalancing.
+	rebalanceStart time.Time
+	membersBefore  int
+	preparing      time.Duration
+	completing     time.Duration
+
+	completed []time.Time
+	events    []RebalanceEvent
+}
+
+// rebalanceTracker builds rebalance timelines by comparing successive
+// descriptions of each group.
+type rebalanceTracker struct {
+	mu     sync.Mutex
+	groups map[string]*groupTimeline
+	recent []RebalanceEvent
+	seq    int64
+}
+
+func newRebalanceTracker() *rebalanceTracker {
+	return &rebalanceTracker{groups: make(map[string]*groupTimeline)}
+}
+
+func isRebalancing(state string) bool {
+	return state == "PreparingRebalance" || state == "CompletingRebalance"
+}
+
+func (t *rebalanceTracker) observe(description *sarama.GroupDescription, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	members := make(map[string]rebalanceMember, len(description.Members))
+	for memberID, member := range description.Members {
+		members[memberID] = rebalanceMember{clientID: member.ClientId, host: member.ClientHost}
+	}
+
+	timeline, ok := t.groups[description.GroupId]
+	if !ok {
+		t.groups[description.GroupId] = &groupTimeline{
+			state:        description.State,
+			stateSince:   now,
+			members:      members,
+			watchedSince: now,
+			lastSeen:     now,
+		}
+		if isRebalancing(description.State) {
+			t.groups[description.GroupId].rebalanceStart = now
+		}
+		return
+	}
+	timeline.lastSeen = now
+	event := func(e RebalanceEvent) {
+		t.seq++
+		e.Seq = t.seq
+		e.Time = now
+		e.Group = description.GroupId
+		e.Generation = timeline.generation
+		timeline.events = append(timeline.events, e)
+		if len(timeline.events) > maxGroupEvents {
+			timeline.events = timeline.events[len(timeline.events)-maxGroupEvents:]
+		}
+		t.recent = append(t.recent, e)
+		if len(t.recent) > maxRecentEvents {
+			t.recent = t.recent[len(t.recent)-maxRecentEvents:]
+		}
+	}
+
+	for memberID, member := range members {
+		if _, ok := timeline.members[memberID]; !ok {
+			event(RebalanceEvent{Type: RebalanceMemberJoin, MemberID: memberID, ClientID: member.clientID, Host: member.host})
+		}
+	}
+	for memberID, member := range timeline.members {
+		if _, ok := members[memberID]; !ok {
+			event(RebalanceEvent{Type: RebalanceMemberLeave, MemberID: memberID, ClientID: member.clientID, Host: member.host})
+		}
+	}
+
+	previous := timeline.state
+	if previous != description.State {
+		event(RebalanceEvent{Type: RebalanceStateChange, From: previous, To: description.State})
+
+		// Time in a rebalance state is counted up to this observation.
+		switch previous {
+		case "PreparingRebalance":
+			timeline.preparing += now.Sub(timeline.stateSince)
+		case "CompletingRebalance":
+			timeline.completing += now.Sub(timeline.stateSince)
+		}
+		timeline.state = description.State
+		timeline.stateSince = now
+	}
+
+	rebalancing := isRebalancing(description.State)
+	switch {
+	case rebalancing && timeline.rebalanceStart.IsZero():
+		timeline.rebalanceStart = now
+		timeline.membersBefore = len(timeline.members)
+		event(RebalanceEvent{Type: RebalanceStarted, From: previous, MembersBefore: len(timeline.members)})
+	case !rebalancing && !timeline.rebalanceStart.IsZero():
+		t.completeRebalance(timeline, timeline.membersBefore, len(members), now, event)
+	case !rebalancing && description.State == "Stable" && previous == "Stable" && !sameMembers(timeline.members, members):
+		// The whole rebalance happened between two polls.
+		t.completeRebalance(timeline, len(timeline.members), len(members), now, event)
+	}
+	timeline.members = members
+}
+
+func (t *rebalanceTracker) completeRebalance(timeline *groupTimeline, before, after int, now time.Time, event func(RebalanceEvent)) {
+	timeline.generation++
+	event(RebalanceEvent{Type: RebalanceGeneration})
+	event(RebalanceEvent{
+		Type:              RebalanceCompleted,
+		To:                timeline.state,
+		PreparingSeconds:  timeline.preparing.Seconds(),
+		CompletingSeconds: timeline.completing.Seconds(),
+		MembersBefore:     before,
+		MembersAfter:      after,
+	})
+	timeline.completed = append(timeline.completed, now)
+	timeline.rebalanceStart = time.Time{}
+	timeline.preparing, timeline.completing = 0, 0
+}
+
+func sameMembers(a, b map[string]rebalanceMember) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for memberID := range a {
+		if _, ok := b[memberID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// forget drops groups that no longer exist once their timeline has aged
+// out, and expires old rebalance counts.
+func (t *rebalanceTracker) forget(keep map[string]*sarama.GroupDescription, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for group, timeline := range t.groups {
+		if _, ok := keep[group]; !ok && now.Sub(timeline.lastSeen) > rebalanceWindow {
+			delete(t.groups, group)
+			continue
+		}
+		for len(timeline.completed) > 0 && now.Sub(timeline.completed[0]) > rebalanceWindow {
+			timeline.completed = timeline.completed[1:]
+		}
+	}
+}
+
+func (t *rebalanceTracker) stats(group string, now time.Time) (RebalanceStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timeline, ok := t.groups[group]
+	if !ok {
+		return RebalanceStats{}, false
+	}
+	stats := RebalanceStats{Generation: timeline.generation, WatchedSince: timeline.watchedSince}
+	for _, completed := range timeline.completed {
+		if now.Sub(completed) <= time.Hour {
+			stats.LastHour++
+		}
+		if now.Sub(completed) <= rebalanceWindow {
+			stats.LastDay++
+		}
+	}
+	if n := len(timeline.completed); n > 0 {
+		last := timeline.completed[n-1]
+		stats.LastRebalance = &last
+	}
+	return stats, true
+}
+
+func (t *rebalanceTracker) timeline(group string, now time.Time) (*GroupRebalances, bool) {
+	stats, ok := t.stats(group, now)
+	if !ok {
+		return nil, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timeline := t.groups[group]
+	events := make([]RebalanceEvent, len(timeline.events))
+	copy(events, timeline.events)
+	return &GroupRebalances{Group: group, State: timeline.state, RebalanceStats: stats, Events: events}, true
+}
+
+// eventsSince returns the events after seq, optionally of one group.
+func (t *rebalanceTracker) eventsSince(seq int64, group string) []RebalanceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := sort.Search(len(t.recent), func(i int) bool { return t.recent[i].Seq > seq })
+	var events []RebalanceEvent
+	for _, event := range t.recent[i:] {
+		if group == "" || event.Group == group {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (t *rebalanceTracker) lastSeq() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seq
+}
+
+func (s *Server) serveGroupRebalances(w http.ResponseWriter, r *http.Request, group string) {
+	timeline, ok := s.rebalances.timeline(group, time.Now())
+	if !ok {
+		http.Error(w, fmt.Sprintf("Group %s has not been observed", group), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeline)
+}
+
+// serveRebalanceWebSocket streams rebalance events as they are observed,
+// optionally only those of the group query parameter. With since=N it
+// first replays the buffered events after sequence number N.
+func (s *Server) serveRebalanceWebSocket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	group := query.Get("group")
+	seq := s.rebalances.lastSeq()
+	if raw := query.Get("since"); raw != "" {
+		since, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since %q", raw), http.StatusBadRequest)
+			return
+		}
+		seq = since
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		for _, event := range s.rebalances.eventsSince(seq, group) {
+			if err := conn.WriteJSON(event); err != nil {
+				log.Println("WebSocket write error:", err)
+				return
+			}
+			seq = event.Seq
+		}
+
+		select {
+		case <-ticker.C:
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
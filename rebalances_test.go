@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func groupDescription(group, state string, members ...string) *sarama.GroupDescription {
+	description := &sarama.GroupDescription{
+		GroupId: group,
+		State:   state,
+		Members: make(map[string]*sarama.GroupMemberDescription, len(members)),
+	}
+	for _, member := range members {
+		description.Members[member] = &sarama.GroupMemberDescription{ClientId: "client-" + member, ClientHost: "/10.0.0.1"}
+	}
+	return description
+}
+
+func eventTypes(events []RebalanceEvent) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestRebalanceTrackerObservedRebalance(t *testing.T) {
+	tracker := newRebalanceTracker()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.observe(groupDescription("billing", "Stable", "a"), start)
+	tracker.observe(groupDescription("billing", "PreparingRebalance", "a", "b"), start.Add(5*time.Second))
+	tracker.observe(groupDescription("billing", "CompletingRebalance", "a", "b"), start.Add(10*time.Second))
+	tracker.observe(groupDescription("billing", "Stable", "a", "b"), start.Add(12*time.Second))
+
+	timeline, ok := tracker.timeline("billing", start.Add(time.Minute))
+	if !ok {
+		t.Fatal("billing has no timeline")
+	}
+	want := []string{
+		RebalanceMemberJoin, RebalanceStateChange, RebalanceStarted,
+		RebalanceStateChange,
+		RebalanceStateChange, RebalanceGeneration, RebalanceCompleted,
+	}
+	if got := eventTypes(timeline.Events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+
+	if joined := timeline.Events[0]; joined.MemberID != "b" || joined.ClientID != "client-b" || joined.Generation != 0 {
+		t.Errorf("member-joined event = %+v", joined)
+	}
+	if started := timeline.Events[2]; started.From != "Stable" || started.MembersBefore != 1 {
+		t.Errorf("rebalance-started event = %+v", started)
+	}
+	completed := timeline.Events[6]
+	if completed.PreparingSeconds != 5 || completed.CompletingSeconds != 2 ||
+		completed.MembersBefore != 1 || completed.MembersAfter != 2 ||
+		completed.Generation != 1 || completed.To != "Stable" {
+		t.Errorf("rebalance-completed event = %+v", completed)
+	}
+
+	if timeline.Generation != 1 || timeline.LastHour != 1 || timeline.LastDay != 1 || timeline.State != "Stable" {
+		t.Errorf("stats = %+v", timeline.RebalanceStats)
+	}
+	if timeline.LastRebalance == nil || !timeline.LastRebalance.Equal(start.Add(12*time.Second)) {
+		t.Errorf("LastRebalance = %v, want %v", timeline.LastRebalance, start.Add(12*time.Second))
+	}
+	for i := 1; i < len(timeline.Events); i++ {
+		if timeline.Events[i].Seq <= timeline.Events[i-1].Seq {
+			t.Fatalf("events are not in sequence: %+v", timeline.Events)
+		}
+	}
+}
+
+func TestRebalanceTrackerRebalanceBetweenPolls(t *testing.T) {
+	tracker := newRebalanceTracker()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.observe(groupDescription("billing", "Stable", "a"), start)
+	tracker.observe(groupDescription("billing", "Stable", "b"), start.Add(5*time.Second))
+
+	timeline, _ := tracker.timeline("billing", start.Add(time.Minute))
+	want := []string{RebalanceMemberJoin, RebalanceMemberLeave, RebalanceGeneration, RebalanceCompleted}
+	if got := eventTypes(timeline.Events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	completed := timeline.Events[3]
+	if completed.PreparingSeconds != 0 || completed.CompletingSeconds != 0 || completed.MembersBefore != 1 || completed.MembersAfter != 1 {
+		t.Errorf("rebalance-completed event = %+v", completed)
+	}
+	if timeline.Generation != 1 {
+		t.Errorf("Generation = %d, want 1", timeline.Generation)
+	}
+}
+
+func TestRebalanceTrackerFirstObservation(t *testing.T) {
+	tracker := newRebalanceTracker()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.observe(groupDescription("billing", "Stable", "a", "b"), now)
+	tracker.observe(groupDescription("billing", "Stable", "a", "b"), now.Add(5*time.Second))
+
+	timeline, ok := tracker.timeline("billing", now)
+	if !ok || len(timeline.Events) != 0 || timeline.Generation != 0 || !timeline.WatchedSince.Equal(now) {
+		t.Errorf("got %+v, want a quiet timeline watched since %v", timeline, now)
+	}
+	if _, ok := tracker.timeline("unknown", now); ok {
+		t.Error("unobserved group has a timeline")
+	}
+}
+
+func TestRebalanceTrackerEventsSince(t *testing.T) {
+	tracker := newRebalanceTracker()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.observe(groupDescription("billing", "Stable", "a"), now)
+	tracker.observe(groupDescription("shipping", "Stable", "x"), now)
+	tracker.observe(groupDescription("billing", "Stable", "a", "b"), now.Add(time.Second))
+	seq := tracker.lastSeq()
+	tracker.observe(groupDescription("shipping", "Empty"), now.Add(2*time.Second))
+
+	if got := tracker.eventsSince(0, "billing"); len(got) == 0 || got[0].Group != "billing" {
+		t.Errorf("billing events = %+v", got)
+	}
+	for _, event := range tracker.eventsSince(0, "billing") {
+		if event.Group != "billing" {
+			t.Errorf("event of %s in billing's events", event.Group)
+		}
+	}
+	after := tracker.eventsSince(seq, "")
+	if len(after) == 0 {
+		t.Fatal("no events after the last billing event")
+	}
+	for _, event := range after {
+		if event.Seq <= seq || event.Group != "shipping" {
+			t.Errorf("event %+v is not a shipping event after %d", event, seq)
+		}
+	}
+}
+
+func TestRebalanceTrackerForget(t *testing.T) {
+	tracker := newRebalanceTracker()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tracker.observe(groupDescription("billing", "Stable", "a"), start)
+	tracker.observe(groupDescription("billing", "Stable", "b"), start.Add(time.Second))
+	tracker.observe(groupDescription("gone", "Empty"), start)
+
+	keep := map[string]*sarama.GroupDescription{"billing": groupDescription("billing", "Stable", "b")}
+	tracker.forget(keep, start.Add(time.Hour))
+	if _, ok := tracker.timeline("gone", start); !ok {
+		t.Error("a group that disappeared was forgotten before its timeline aged out")
+	}
+
+	later := start.Add(rebalanceWindow + 2*time.Hour)
+	tracker.forget(keep, later)
+	if _, ok := tracker.timeline("gone", later); ok {
+		t.Error("a group gone for longer than the window was kept")
+	}
+	stats, ok := tracker.stats("billing", later)
+	if !ok || stats.LastDay != 0 || stats.Generation != 1 {
+		t.Errorf("billing stats = %+v, want the rebalance expired but the generation kept", stats)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// clusterRefresher tracks the state of the background metadata refresh
+// loop. The snapshot itself lives in Server.clusterStatus.
+type clusterRefresher struct {
+	mu        sync.Mutex // serialises refreshes
+	errMu     sync.RWMutex
+	lastError error
+}
+
+func (c *clusterRefresher) setError(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	c.lastError = err
+}
+
+func (c *clusterRefresher) err() error {
+	c.errMu.RLock()
+	defer c.errMu.RUnlock()
+	return c.lastError
+}
+
+// refreshClusterStatus rebuilds the cluster snapshot on a fixed interval and
+// immediately whenever the metadata source reports a change. It runs until
+// the server is closed.
+func (s *Server) refreshClusterStatus() {
+	interval := time.Duration(s.config.MetadataRefreshInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	events := s.source.Watch(s.done)
+	s.refreshNow()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			log.Printf("Cluster metadata changed (%s), refreshing", event.Type)
+		}
+
+		s.refreshNow()
+	}
+}
+
+// refreshNow builds a new snapshot and publishes it atomically. On failure
+// the previous snapshot is kept and marked stale.
+func (s *Server) refreshNow() {
+	s.refresh.mu.Lock()
+	defer s.refresh.mu.Unlock()
+
+	start := time.Now()
+	status, err := s.fetchClusterMetadata()
+	if err != nil {
+		log.Println("Failed to refresh cluster metadata:", err)
+		s.refresh.setError(err)
+		return
+	}
+
+	status.LastUpdated = time.Now()
+	status.RefreshDuration = time.Since(start).Milliseconds()
+	s.clusterStatus.Store(status)
+	s.refresh.setError(nil)
+}
+
+// currentClusterStatus returns a copy of the latest snapshot with its
+// staleness filled in. If no snapshot exists yet it refreshes synchronously.
+func (s *Server) currentClusterStatus() *ClusterStatus {
+	if s.clusterStatus.Load() == nil {
+		s.refreshNow()
+	}
+	return s.snapshotClusterStatus()
+}
+
+// snapshotClusterStatus is currentClusterStatus without the synchronous
+// first refresh, for callers that must not block on the cluster.
+func (s *Server) snapshotClusterStatus() *ClusterStatus {
+	status := s.clusterStatus.Load()
+
+	var snapshot ClusterStatus
+	if status != nil {
+		snapshot = *status
+	}
+
+	staleAfter := time.Duration(s.config.MetadataStaleAfter) * time.Second
+	if err := s.refresh.err(); err != nil {
+		snapshot.Stale = true
+		snapshot.LastError = err.Error()
+	} else if status == nil || (staleAfter > 0 && time.Since(status.LastUpdated) > staleAfter) {
+		snapshot.Stale = true
+	}
+
+	return &snapshot
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Partitioning modes of a replay.
+const (
+	PartitionByKey    = "key"
+	PartitionPreserve = "preserve"
+)
+
+// replayBatchSize is how many records a replay hands to the producer at a
+// time.
+const replayBatchSize = 500
+
+// ReplayRequest copies a range of records from the topic in the URL to
+// Destination, which may be the same topic. Keys, values and headers are
+// copied as they are unless Transform says otherwise.
+//
+// Partitioning "key" (the default) lets the key choose the destination
+// partition and "preserve" keeps each record's partition number, modulo the
+// destination's partition count. PartitionMap sends the listed source
+// partitions to fixed destination partitions and takes precedence over
+// both. RatePerSecond caps how fast records are produced; DryRun only
+// counts what would be produced.
+type ReplayRequest struct {
+	MessageRange
+	Destination        string           `json:"destination"`
+	Filter             string           `json:"filter"`
+	Transform          *ReplayTransform `json:"transform"`
+	PreserveTimestamps bool             `json:"preserveTimestamps"`
+	Partitioning       string           `json:"partitioning"`
+	PartitionMap       map[int32]int32  `json:"partitionMap"`
+	RatePerSecond      int              `json:"ratePerSecond"`
+	DryRun             bool             `json:"dryRun"`
+}
+
+// ReplayTransform rewrites records on their way to the destination. Key and
+// Value are filter operands, such as $.order.id or $.payload, whose result
+// replaces the key or value; strings are sent as their text and anything
+// else as JSON. A record whose operand is missing is skipped.
+type ReplayTransform struct {
+	Key           string          `json:"key"`
+	Value         string          `json:"value"`
+	SetHeaders    []ProduceHeader `json:"setHeaders"`
+	RemoveHeaders []string        `json:"removeHeaders"`
+}
+
+// ReplayResult is reported with a finished replay job.
+type ReplayResult struct {
+	Matched         int64            `json:"matched"`
+	Produced        int64            `json:"produced"`
+	Skipped         int64            `json:"skipped"`
+	DryRun          bool             `json:"dryRun"`
+	ShortPartitions []ShortPartition `json:"shortPartitions,omitempty"`
+}
+
+// replayPlan is a validated ReplayRequest.
+type replayPlan struct {
+	*ReplayRequest
+	source    string
+	filter    *MessageFilter
+	key       *FieldExtractor
+	value     *FieldExtractor
+	removed   map[string]bool
+	destCount int32
+}
+
+func (s *Server) newReplayPlan(source string, req *ReplayRequest) (*replayPlan, error) {
+	plan := &replayPlan{ReplayRequest: req, source: source}
+
+	if req.Destination == "" {
+		return nil, fmt.Errorf("destination is required")
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	switch req.Partitioning {
+	case "":
+		req.Partitioning = PartitionByKey
+	case PartitionByKey, PartitionPreserve:
+	default:
+		return nil, fmt.Errorf("unknown partitioning %q, expected key or preserve", req.Partitioning)
+	}
+	if req.RatePerSecond < 0 {
+		return nil, fmt.Errorf("ratePerSecond must not be negative")
+	}
+
+	if req.Filter != "" {
+		filter, err := CompileFilter(req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		plan.filter = filter
+	}
+
+	if t := req.Transform; t != nil {
+		var err error
+		if t.Key != "" {
+			if plan.key, err = CompileFieldExtractor(t.Key); err != nil {
+				return nil, fmt.Errorf("transform key: %w", err)
+			}
+		}
+		if t.Value != "" {
+			if plan.value, err = CompileFieldExtractor(t.Value); err != nil {
+				return nil, fmt.Errorf("transform value: %w", err)
+			}
+		}
+		plan.removed = make(map[string]bool, len(t.RemoveHeaders))
+		for _, name := range t.RemoveHeaders {
+			plan.removed[name] = true
+		}
+	}
+
+	if s.kafkaConn == nil {
+		return nil, fmt.Errorf("no Kafka client configured")
+	}
+	partitions, err := s.kafkaConn.Partitions(req.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("destination %s: %w", req.Destination, err)
+	}
+	plan.destCount = int32(len(partitions))
+	for from, to := range req.PartitionMap {
+		if to < 0 || to >= plan.destCount {
+			return nil, fmt.Errorf("partitionMap sends %d to %d, but %s has %d partitions", from, to, req.Destination, plan.destCount)
+		}
+	}
+
+	return plan, nil
+}
+
+func (s *Server) startReplay(w http.ResponseWriter, r *http.Request, topic string) {
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := s.newReplayPlan(topic, &req)
+	if err != nil {
+		if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := s.jobs.Start("replay", func(ctx context.Context, progress *JobProgress) (interface{}, error) {
+		return s.replay(ctx, plan, progress)
+	}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// replay copies the records selected by plan. The range is resolved when
+// the job starts, so replaying a topic onto itself doesn't read its own
+// output.
+func (s *Server) replay(ctx context.Context, plan *replayPlan, progress *JobProgress) (*ReplayResult, error) {
+	result := &ReplayResult{DryRun: plan.DryRun}
+
+	var producer sarama.SyncProducer
+	if !plan.DryRun {
+		var err error
+		if producer, err = s.producer(); err != nil {
+			return result, err
+		}
+	}
+
+	// A rate limited replay sends about ten batches a second so the
+	// destination sees a steady rate rather than bursts.
+	batchSize := replayBatchSize
+	if plan.RatePerSecond > 0 {
+		batchSize = min(max(plan.RatePerSecond/10, 1), replayBatchSize)
+	}
+	limiter := newRateLimiter(plan.RatePerSecond)
+	batch := make([]*sarama.ProducerMessage, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := producer.SendMessages(batch)
+		var producerErrors sarama.ProducerErrors
+		if errors.As(err, &producerErrors) {
+			result.Produced += int64(len(batch) - len(producerErrors))
+			return fmt.Errorf("failed to produce %d records: %w", len(producerErrors), producerErrors[0].Err)
+		}
+		if err != nil {
+			return err
+		}
+		result.Produced += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	short, err := s.scanRange(ctx, plan.source, &plan.MessageRange, progress, func(msg *sarama.ConsumerMessage) error {
+		if !s.matchMessage(plan.filter, msg) {
+			return nil
+		}
+		result.Matched++
+
+		out, ok := s.replayMessage(plan, msg)
+		if !ok {
+			result.Skipped++
+			return nil
+		}
+		if plan.DryRun {
+			return nil
+		}
+
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+		batch = append(batch, out)
+		if len(batch) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	result.ShortPartitions = short
+	if err != nil {
+		return result, err
+	}
+	if !plan.DryRun {
+		if err := flush(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// replayMessage builds the record to produce for msg. It reports false when
+// the transform can't be applied to msg.
+func (s *Server) replayMessage(plan *replayPlan, msg *sarama.ConsumerMessage) (*sarama.ProducerMessage, bool) {
+	out := &sarama.ProducerMessage{Topic: plan.Destination}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if msg.Value != nil {
+		out.Value = sarama.ByteEncoder(msg.Value)
+	}
+
+	if plan.key != nil || plan.value != nil {
+		value := msg.Value
+		if decoded, err := s.decoders.Decode(msg.Value); err == nil && decoded != nil {
+			value = decoded.JSON
+		}
+		c := &filterContext{msg: msg, rawValue: value}
+		if plan.key != nil {
+			key, ok := plan.key.extract(c)
+			if !ok {
+				return nil, false
+			}
+			out.Key = sarama.StringEncoder(formatFieldValue(key))
+		}
+		if plan.value != nil {
+			v, ok := plan.value.extract(c)
+			if !ok {
+				return nil, false
+			}
+			out.Value = sarama.StringEncoder(formatFieldValue(v))
+		}
+	}
+
+	for _, header := range msg.Headers {
+		if header == nil || plan.removed[string(header.Key)] {
+			continue
+		}
+		out.Headers = append(out.Headers, *header)
+	}
+	if plan.Transform != nil {
+		for _, header := range plan.Transform.SetHeaders {
+			out.Headers = setRecordHeader(out.Headers, header.Key, header.Value)
+		}
+	}
+
+	if plan.PreserveTimestamps {
+		out.Timestamp = msg.Timestamp
+	}
+
+	if to, ok := plan.PartitionMap[msg.Partition]; ok {
+		out.Partition = to
+		out.Metadata = explicitPartition{}
+	} else if plan.Partitioning == PartitionPreserve {
+		out.Partition = msg.Partition % plan.destCount
+		out.Metadata = explicitPartition{}
+	}
+	return out, true
+}
+
+func setRecordHeader(headers []sarama.RecordHeader, key, value string) []sarama.RecordHeader {
+	for i := range headers {
+		if string(headers[i].Key) == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+	return append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// rateLimiter paces calls to wait to at most perSecond a second. A zero
+// rate doesn't limit.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	if perSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return nil
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Throughput windows reported for every topic and partition.
+var throughputWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// ThroughputRates holds messages per second over each throughput window.
+type ThroughputRates struct {
+	OneMinute      float64 `json:"1m"`
+	FiveMinutes    float64 `json:"5m"`
+	FifteenMinutes float64 `json:"15m"`
+}
+
+// TopicThroughput is the sampler's view of a single topic.
+type TopicThroughput struct {
+	Rates          ThroughputRates
+	PartitionRates map[int32]ThroughputRates
+	Active         bool
+	LastProduced   time.Time
+}
+
+type offsetSample struct {
+	time   time.Time
+	offset int64
+}
+
+type partitionSamples struct {
+	samples      []offsetSample
+	lastProduced time.Time
+}
+
+// OffsetSampler periodically records the newest offset of every partition
+// and derives produce rates from the deltas between samples.
+type OffsetSampler struct {
+	source       ClusterMetadataSource
+	interval     time.Duration
+	activeWindow time.Duration
+	retention    time.Duration
+
+	mu     sync.RWMutex
+	topics map[string]map[int32]*partitionSamples
+}
+
+func NewOffsetSampler(source ClusterMetadataSource, interval, activeWindow time.Duration) *OffsetSampler {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if activeWindow <= 0 {
+		activeWindow = time.Minute
+	}
+
+	return &OffsetSampler{
+		source:       source,
+		interval:     interval,
+		activeWindow: activeWindow,
+		// Keep one extra sample beyond the largest window so it always has
+		// a starting point.
+		retention: throughputWindows[len(throughputWindows)-1] + interval,
+		topics:    make(map[string]map[int32]*partitionSamples),
+	}
+}
+
+// Run samples every interval until done is closed.
+func (o *OffsetSampler) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		o.sample()
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *OffsetSampler) sample() {
+	topics, err := o.source.ListTopics()
+	if err != nil {
+		log.Println("Offset sampler failed to list topics:", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	offsets := make([]map[int32]PartitionOffsets, len(topics))
+	for i, topic := range topics {
+		wg.Add(1)
+		go func(i int, topic string) {
+			defer wg.Done()
+			topicOffsets, err := o.source.PartitionOffsets(topic)
+			if err != nil {
+				log.Printf("Offset sampler failed to read offsets for %s: %v", topic, err)
+				return
+			}
+			offsets[i] = topicOffsets
+		}(i, topic)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	seen := make(map[string]bool, len(topics))
+	for i, topic := range topics {
+		seen[topic] = true
+		if offsets[i] == nil {
+			continue
+		}
+		o.record(topic, offsets[i], now)
+	}
+
+	for topic := range o.topics {
+		if !seen[topic] {
+			delete(o.topics, topic)
+		}
+	}
+}
+
+// record appends a sample per partition. Callers must hold o.mu.
+func (o *OffsetSampler) record(topic string, offsets map[int32]PartitionOffsets, now time.Time) {
+	partitions, ok := o.topics[topic]
+	if !ok {
+		partitions = make(map[int32]*partitionSamples)
+		o.topics[topic] = partitions
+	}
+
+	for partition, offset := range offsets {
+		p, ok := partitions[partition]
+		if !ok {
+			p = &partitionSamples{}
+			partitions[partition] = p
+		}
+
+		if n := len(p.samples); n > 0 {
+			last := p.samples[n-1].offset
+			if offset.Newest < last {
+				// The topic was recreated; earlier samples are meaningless.
+				p.samples = nil
+			} else if offset.Newest > last {
+				p.lastProduced = now
+			}
+		}
+
+		p.samples = append(p.samples, offsetSample{time: now, offset: offset.Newest})
+
+		cutoff := now.Add(-o.retention)
+		trim := 0
+		for trim < len(p.samples)-1 && p.samples[trim].time.Before(cutoff) {
+			trim++
+		}
+		p.samples = p.samples[trim:]
+	}
+}
+
+// Throughput returns the windowed rates for topic. Topics that have not
+// been sampled at least twice report zero rates.
+func (o *OffsetSampler) Throughput(topic string) TopicThroughput {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	now := time.Now()
+	throughput := TopicThroughput{
+		PartitionRates: make(map[int32]ThroughputRates),
+	}
+
+	for partition, p := range o.topics[topic] {
+		rates := ThroughputRates{
+			OneMinute:      p.rate(now, throughputWindows[0]),
+			FiveMinutes:    p.rate(now, throughputWindows[1]),
+			FifteenMinutes: p.rate(now, throughputWindows[2]),
+		}
+		throughput.PartitionRates[partition] = rates
+		throughput.Rates.OneMinute += rates.OneMinute
+		throughput.Rates.FiveMinutes += rates.FiveMinutes
+		throughput.Rates.FifteenMinutes += rates.FifteenMinutes
+
+		if p.lastProduced.After(throughput.LastProduced) {
+			throughput.LastProduced = p.lastProduced
+		}
+	}
+
+	throughput.Active = !throughput.LastProduced.IsZero() && now.Sub(throughput.LastProduced) <= o.activeWindow
+	return throughput
+}
+
+// rate computes messages per second between the oldest sample inside the
+// window and the newest sample.
+func (p *partitionSamples) rate(now time.Time, window time.Duration) float64 {
+	if len(p.samples) < 2 {
+		return 0
+	}
+
+	last := p.samples[len(p.samples)-1]
+	cutoff := now.Add(-window)
+	first := last
+	for _, sample := range p.samples {
+		if !sample.time.Before(cutoff) {
+			first = sample
+			break
+		}
+	}
+
+	elapsed := last.time.Sub(first.time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.offset-first.offset) / elapsed
+}
+
+// ProducedAt estimates when the record at offset was produced by linear
+// interpolation between the two samples that bracket it, and returns the
+// time the newest record was first seen. ok is false when offset predates
+// the retained samples.
+func (o *OffsetSampler) ProducedAt(topic string, partition int32, offset int64) (producedAt, newestAt time.Time, ok bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	p, found := o.topics[topic][partition]
+	if !found {
+		return time.Time{}, time.Time{}, false
+	}
+
+	for i := 1; i < len(p.samples); i++ {
+		before, after := p.samples[i-1], p.samples[i]
+		if before.offset > offset || after.offset <= offset {
+			continue
+		}
+
+		fraction := float64(offset+1-before.offset) / float64(after.offset-before.offset)
+		elapsed := time.Duration(fraction * float64(after.time.Sub(before.time)))
+		return before.time.Add(elapsed), p.lastProduced, true
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+// LatestOffsets returns the most recently sampled newest offset of every
+// partition, keyed by topic.
+func (o *OffsetSampler) LatestOffsets() map[string]map[int32]int64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	latest := make(map[string]map[int32]int64, len(o.topics))
+	for topic, partitions := range o.topics {
+		latest[topic] = make(map[int32]int64, len(partitions))
+		for partition, p := range partitions {
+			if n := len(p.samples); n > 0 {
+				latest[topic][partition] = p.samples[n-1].offset
+			}
+		}
+	}
+	return latest
+}
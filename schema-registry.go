@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema types, as named by the Schema Registry API.
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+)
+
+// Schema is a registered schema. References maps import names to schema
+// text and is only used by Protobuf schemas.
+type Schema struct {
+	ID         int
+	Type       string
+	Text       string
+	References map[string]string
+}
+
+// SchemaSource looks schemas up by their registry ID.
+type SchemaSource interface {
+	Schema(id int) (*Schema, error)
+}
+
+// SchemaRegistryClient reads schemas from a Schema Registry compatible HTTP
+// API. Schemas are immutable once registered, so they are cached forever.
+type SchemaRegistryClient struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[int]*Schema
+}
+
+func NewSchemaRegistryClient(baseURL, username, password string) *SchemaRegistryClient {
+	return &SchemaRegistryClient{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		cache:    make(map[int]*Schema),
+	}
+}
+
+type registrySchemaResponse struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+	References []struct {
+		Name    string `json:"name"`
+		Subject string `json:"subject"`
+		Version int    `json:"version"`
+	} `json:"references"`
+}
+
+func (c *SchemaRegistryClient) Schema(id int) (*Schema, error) {
+	c.mu.Lock()
+	schema, ok := c.cache[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp registrySchemaResponse
+	if err := c.get(fmt.Sprintf("/schemas/ids/%d", id), &resp); err != nil {
+		return nil, err
+	}
+
+	schema = &Schema{
+		ID:         id,
+		Type:       schemaType(resp.SchemaType),
+		Text:       resp.Schema,
+		References: make(map[string]string),
+	}
+	if err := c.resolveReferences(resp, schema.References); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// resolveReferences fetches every schema resp refers to, transitively.
+func (c *SchemaRegistryClient) resolveReferences(resp registrySchemaResponse, references map[string]string) error {
+	for _, ref := range resp.References {
+		if _, ok := references[ref.Name]; ok {
+			continue
+		}
+
+		var referenced registrySchemaResponse
+		path := fmt.Sprintf("/subjects/%s/versions/%d", url.PathEscape(ref.Subject), ref.Version)
+		if err := c.get(path, &referenced); err != nil {
+			return fmt.Errorf("failed to fetch reference %s: %w", ref.Name, err)
+		}
+		references[ref.Name] = referenced.Schema
+
+		if err := c.resolveReferences(referenced, references); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SchemaRegistryClient) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("schema registry returned %s for %s: %s", resp.Status, path, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// FileSchemaStore serves schemas from a directory for environments without
+// a registry. A schema with ID 42 is read from 42.avsc, 42.proto or 42.json
+// (JSON Schema); every .proto file in the directory can be imported by its
+// path relative to the directory.
+type FileSchemaStore struct {
+	dir string
+}
+
+func NewFileSchemaStore(dir string) *FileSchemaStore {
+	return &FileSchemaStore{dir: dir}
+}
+
+var schemaFileTypes = map[string]string{
+	".avsc":  SchemaTypeAvro,
+	".proto": SchemaTypeProtobuf,
+	".json":  SchemaTypeJSON,
+}
+
+func (f *FileSchemaStore) Schema(id int) (*Schema, error) {
+	for ext, typ := range schemaFileTypes {
+		data, err := os.ReadFile(filepath.Join(f.dir, strconv.Itoa(id)+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		schema := &Schema{ID: id, Type: typ, Text: string(data)}
+		if typ == SchemaTypeProtobuf {
+			if schema.References, err = f.protoFiles(); err != nil {
+				return nil, err
+			}
+		}
+		return schema, nil
+	}
+	return nil, fmt.Errorf("schema %d not found in %s", id, f.dir)
+}
+
+func (f *FileSchemaStore) protoFiles() (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(f.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".proto" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+// schemaType maps the registry's schemaType field, which is omitted for
+// Avro, to one of the SchemaType constants.
+func schemaType(raw string) string {
+	if raw == "" {
+		return SchemaTypeAvro
+	}
+	return strings.ToUpper(raw)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Ways a time lag can be estimated, reported alongside the estimate.
+const (
+	LagEstimateTimestamp    = "timestamp"
+	LagEstimateInterpolated = "interpolated"
+	LagEstimateUnknown      = "unknown"
+)
+
+const (
+	recordReadTimeout   = 2 * time.Second
+	timestampCacheLimit = 10000
+	// timeLagWorkers bounds the records read at once by one estimate, and
+	// timeLagReadBudget how long an estimate keeps starting reads; the
+	// remaining lags are interpolated.
+	timeLagWorkers    = 8
+	timeLagReadBudget = 3 * time.Second
+	// newestTimestampTTL is how long the timestamp of a partition's newest
+	// record is reused while the log end moves on, and failedReadTTL how
+	// long a record that couldn't be read, such as a transaction marker,
+	// isn't tried again.
+	newestTimestampTTL = 10 * time.Second
+	failedReadTTL      = time.Minute
+)
+
+type cachedTimestamp struct {
+	ts     time.Time
+	err    error
+	offset int64
+	readAt time.Time
+}
+
+// timestampCache remembers record timestamps, which never change once
+// written, so repeated lag estimates don't re-read the same records. It
+// also remembers failed reads for a while, and the newest record read per
+// partition.
+type timestampCache struct {
+	mu         sync.Mutex
+	timestamps map[string]cachedTimestamp
+	newest     map[string]cachedTimestamp
+}
+
+func newTimestampCache() *timestampCache {
+	return &timestampCache{
+		timestamps: make(map[string]cachedTimestamp),
+		newest:     make(map[string]cachedTimestamp),
+	}
+}
+
+func (t *timestampCache) get(topic string, partition int32, offset int64) (cachedTimestamp, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cached, ok := t.timestamps[timestampKey(topic, partition, offset)]
+	if !ok || (cached.err != nil && time.Since(cached.readAt) > failedReadTTL) {
+		return cachedTimestamp{}, false
+	}
+	return cached, true
+}
+
+func (t *timestampCache) put(topic string, partition int32, offset int64, ts time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.timestamps) >= timestampCacheLimit {
+		t.timestamps = make(map[string]cachedTimestamp)
+	}
+	t.timestamps[timestampKey(topic, partition, offset)] = cachedTimestamp{ts: ts, err: err, offset: offset, readAt: time.Now()}
+}
+
+// getNewest returns the newest record timestamp read for a partition within
+// newestTimestampTTL, if it is not older than committed.
+func (t *timestampCache) getNewest(topic string, partition int32, committed int64) (cachedTimestamp, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cached, ok := t.newest[timestampKey(topic, partition, -1)]
+	ttl := newestTimestampTTL
+	if cached.err != nil {
+		ttl = failedReadTTL
+	}
+	if !ok || time.Since(cached.readAt) > ttl || cached.offset < committed {
+		return cachedTimestamp{}, false
+	}
+	return cached, true
+}
+
+func (t *timestampCache) putNewest(topic string, partition int32, offset int64, ts time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.newest) >= timestampCacheLimit {
+		t.newest = make(map[string]cachedTimestamp)
+	}
+	t.newest[timestampKey(topic, partition, -1)] = cachedTimestamp{ts: ts, err: err, offset: offset, readAt: time.Now()}
+}
+
+func timestampKey(topic string, partition int32, offset int64) string {
+	return fmt.Sprintf("%s/%d/%d", topic, partition, offset)
+}
+
+// readRecordAt fetches the first record at or after offset. Compacted
+// topics may not have a record at exactly that offset.
+func (s *Server) readRecordAt(topic string, partition int32, offset int64, timeout time.Duration) (*sarama.ConsumerMessage, error) {
+	consumer, err := sarama.NewConsumerFromClient(s.kafkaConn)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	partitionConsumer, err := consumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer partitionConsumer.Close()
+
+	select {
+	case msg := <-partitionConsumer.Messages():
+		return msg, nil
+	case err := <-partitionConsumer.Errors():
+		return nil, err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out reading %s/%d at offset %d", topic, partition, offset)
+	}
+}
+
+func (s *Server) readTimestamp(topic string, partition int32, offset int64) (time.Time, error) {
+	msg, err := s.readRecordAt(topic, partition, offset, recordReadTimeout)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if msg.Timestamp.IsZero() || msg.Timestamp.Unix() <= 0 {
+		return time.Time{}, fmt.Errorf("record %s/%d@%d has no timestamp", topic, partition, offset)
+	}
+	return msg.Timestamp, nil
+}
+
+func (s *Server) recordTimestamp(topic string, partition int32, offset int64) (time.Time, error) {
+	if cached, ok := s.timestamps.get(topic, partition, offset); ok {
+		return cached.ts, cached.err
+	}
+	ts, err := s.readTimestamp(topic, partition, offset)
+	s.timestamps.put(topic, partition, offset, ts, err)
+	return ts, err
+}
+
+// newestTimestamp returns the timestamp of the partition's newest record.
+// On busy partitions the log end moves on between estimates, so the last
+// one read is reused for newestTimestampTTL instead of reading again.
+func (s *Server) newestTimestamp(topic string, partition int32, committed, logEndOffset int64) (time.Time, error) {
+	if cached, ok := s.timestamps.getNewest(topic, partition, committed); ok {
+		return cached.ts, cached.err
+	}
+	ts, err := s.readTimestamp(topic, partition, logEndOffset-1)
+	s.timestamps.putNewest(topic, partition, logEndOffset-1, ts, err)
+	return ts, err
+}
+
+// How getTopicMetrics fills in LagSeconds.
+type timeLagMode int
+
+const (
+	timeLagNone timeLagMode = iota
+	// timeLagInterpolated only uses the offset sampler, which is cheap
+	// enough to do every second.
+	timeLagInterpolated
+	// timeLagRecords reads record timestamps where it can.
+	timeLagRecords
+)
+
+// timeLagQuery is a committed offset to estimate the time lag of.
+type timeLagQuery struct {
+	topic        string
+	partition    int32
+	committed    int64
+	logEndOffset int64
+}
+
+type timeLagEstimate struct {
+	seconds  float64
+	estimate string
+}
+
+// estimateTimeLags returns how many seconds the record at each committed
+// offset was produced before the newest record in its partition. With
+// readRecords it reads both record timestamps, on at most timeLagWorkers
+// goroutines and only during timeLagReadBudget; otherwise, or when the
+// records can't be read (e.g. because the committed record was deleted by
+// retention), it interpolates from the offset sampler.
+func (s *Server) estimateTimeLags(queries []timeLagQuery, readRecords bool) []timeLagEstimate {
+	estimates := make([]timeLagEstimate, len(queries))
+	deadline := time.Now().Add(timeLagReadBudget)
+	work := func(i int) {
+		q := queries[i]
+		if q.committed >= q.logEndOffset {
+			estimates[i] = timeLagEstimate{0, LagEstimateTimestamp}
+			return
+		}
+		if readRecords && s.kafkaConn != nil && time.Now().Before(deadline) {
+			committedTs, err := s.recordTimestamp(q.topic, q.partition, q.committed)
+			if err == nil {
+				newestTs, err := s.newestTimestamp(q.topic, q.partition, q.committed, q.logEndOffset)
+				if err == nil {
+					estimates[i] = timeLagEstimate{clampSeconds(newestTs.Sub(committedTs)), LagEstimateTimestamp}
+					return
+				}
+			}
+		}
+		if producedAt, newestAt, ok := s.sampler.ProducedAt(q.topic, q.partition, q.committed); ok {
+			estimates[i] = timeLagEstimate{clampSeconds(newestAt.Sub(producedAt)), LagEstimateInterpolated}
+			return
+		}
+		estimates[i] = timeLagEstimate{0, LagEstimateUnknown}
+	}
+
+	if readRecords {
+		runWorkers(len(queries), timeLagWorkers, work)
+	} else {
+		for i := range queries {
+			work(i)
+		}
+	}
+	return estimates
+}
+
+func clampSeconds(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return d.Seconds()
+}
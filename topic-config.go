@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+// TopicConfigEntry is one topic configuration value. Source says where the
+// value comes from, using Kafka's names: DEFAULT_CONFIG, STATIC_BROKER_CONFIG,
+// DYNAMIC_DEFAULT_BROKER_CONFIG, DYNAMIC_BROKER_CONFIG or
+// DYNAMIC_TOPIC_CONFIG. Sensitive values are never returned by the broker.
+type TopicConfigEntry struct {
+	Name      string  `json:"name"`
+	Value     *string `json:"value"`
+	Source    string  `json:"source"`
+	Default   bool    `json:"isDefault"`
+	ReadOnly  bool    `json:"readOnly"`
+	Sensitive bool    `json:"sensitive"`
+}
+
+type TopicConfigResponse struct {
+	Topic   string             `json:"topic"`
+	Configs []TopicConfigEntry `json:"configs"`
+}
+
+// TopicConfigUpdate is the body of PATCH /topics/{name}/config. A string
+// sets a config and null removes the topic override so the broker default
+// applies again. Other configs are left as they are.
+type TopicConfigUpdate struct {
+	Configs      map[string]*string `json:"configs"`
+	ValidateOnly bool               `json:"validateOnly"`
+}
+
+var configSourceNames = map[sarama.ConfigSource]string{
+	sarama.SourceUnknown:              "UNKNOWN",
+	sarama.SourceTopic:                "DYNAMIC_TOPIC_CONFIG",
+	sarama.SourceDynamicBroker:        "DYNAMIC_BROKER_CONFIG",
+	sarama.SourceDynamicDefaultBroker: "DYNAMIC_DEFAULT_BROKER_CONFIG",
+	sarama.SourceStaticBroker:         "STATIC_BROKER_CONFIG",
+	sarama.SourceDefault:              "DEFAULT_CONFIG",
+}
+
+func describeTopicConfig(admin sarama.ClusterAdmin, topic string) ([]TopicConfigEntry, error) {
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: topic})
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]TopicConfigEntry, 0, len(entries))
+	for _, entry := range entries {
+		config := TopicConfigEntry{
+			Name:      entry.Name,
+			Source:    configSourceNames[entry.Source],
+			Default:   entry.Default || entry.Source == sarama.SourceDefault,
+			ReadOnly:  entry.ReadOnly,
+			Sensitive: entry.Sensitive,
+		}
+		if !entry.Sensitive {
+			value := entry.Value
+			config.Value = &value
+		}
+		configs = append(configs, config)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+	return configs, nil
+}
+
+func (s *Server) serveTopicConfig(w http.ResponseWriter, r *http.Request, topic string) {
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	configs, err := describeTopicConfig(admin, topic)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe config of topic %s: %v", topic, err), topicConfigErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TopicConfigResponse{Topic: topic, Configs: configs})
+}
+
+// alterTopicConfig applies an incremental update after checking it against
+// the topic's current configs and letting the broker validate it, so a
+// rejected update changes nothing. It responds with the resulting configs.
+func (s *Server) alterTopicConfig(w http.ResponseWriter, r *http.Request, topic string) {
+	var update TopicConfigUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(update.Configs) == 0 {
+		http.Error(w, "No configs to change", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	current, err := describeTopicConfig(admin, topic)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe config of topic %s: %v", topic, err), topicConfigErrorStatus(err))
+		return
+	}
+	known := make(map[string]TopicConfigEntry, len(current))
+	for _, entry := range current {
+		known[entry.Name] = entry
+	}
+
+	entries := make(map[string]sarama.IncrementalAlterConfigsEntry, len(update.Configs))
+	for name, value := range update.Configs {
+		entry, ok := known[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown topic config %s", name), http.StatusBadRequest)
+			return
+		}
+		if entry.ReadOnly {
+			http.Error(w, fmt.Sprintf("Topic config %s is read-only", name), http.StatusBadRequest)
+			return
+		}
+		if value == nil {
+			entries[name] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationDelete}
+		} else {
+			entries[name] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: value}
+		}
+	}
+
+	if err := admin.IncrementalAlterConfig(sarama.TopicResource, topic, entries, true); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid config for topic %s: %v", topic, err), http.StatusBadRequest)
+		return
+	}
+
+	configs := current
+	if !update.ValidateOnly {
+		if err := admin.IncrementalAlterConfig(sarama.TopicResource, topic, entries, false); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to alter config of topic %s: %v", topic, err), http.StatusInternalServerError)
+			return
+		}
+		if configs, err = describeTopicConfig(admin, topic); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to describe config of topic %s: %v", topic, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TopicConfigResponse{Topic: topic, Configs: configs})
+}
+
+func topicConfigErrorStatus(err error) int {
+	var describeErr *sarama.DescribeConfigError
+	if errors.As(err, &describeErr) && describeErr.Err == sarama.ErrUnknownTopicOrPartition {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/IBM/sarama"
+)
+
+// keySampleSize is how many of a topic's newest records are checked for
+// keys before partitions are added.
+const keySampleSize = 200
+
+// PartitionIncrease is the body of POST /topics/{name}/partitions. Count is
+// the new total number of partitions. Assignment optionally lists the
+// replica broker IDs of each new partition, preferred leader first.
+type PartitionIncrease struct {
+	Count        int32     `json:"count"`
+	Assignment   [][]int32 `json:"assignment"`
+	ValidateOnly bool      `json:"validateOnly"`
+}
+
+type PartitionIncreaseResult struct {
+	Topic              string `json:"topic"`
+	PreviousPartitions int32  `json:"previousPartitions"`
+	Partitions         int32  `json:"partitions"`
+	ValidateOnly       bool   `json:"validateOnly"`
+	SampledRecords     int    `json:"sampledRecords"`
+	KeyedRecords       int    `json:"keyedRecords"`
+	Warning            string `json:"warning,omitempty"`
+}
+
+func (s *Server) increasePartitions(w http.ResponseWriter, r *http.Request, topic string) {
+	var req PartitionIncrease
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := s.newClusterAdmin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create admin client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer admin.Close()
+
+	metadata, err := admin.DescribeTopics([]string{topic})
+	if err == nil && len(metadata) == 1 && metadata[0].Err != sarama.ErrNoError {
+		err = metadata[0].Err
+	}
+	if errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		http.Error(w, fmt.Sprintf("Topic %s not found", topic), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to describe topic %s: %v", topic, err), http.StatusInternalServerError)
+		return
+	}
+
+	current := int32(len(metadata[0].Partitions))
+	if req.Count <= current {
+		http.Error(w, fmt.Sprintf("Topic %s already has %d partitions; partitions can only be added", topic, current), http.StatusBadRequest)
+		return
+	}
+	replication := 0
+	if current > 0 {
+		replication = len(metadata[0].Partitions[0].Replicas)
+	}
+	if err := validateAssignment(req.Assignment, req.Count-current, replication); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := PartitionIncreaseResult{
+		Topic:              topic,
+		PreviousPartitions: current,
+		Partitions:         req.Count,
+		ValidateOnly:       req.ValidateOnly,
+	}
+
+	// Keys hash to a partition modulo the partition count, so adding
+	// partitions moves most keys. Warn when the topic looks keyed.
+	if page, err := s.browseMessages(&BrowseRequest{Topic: topic, Limit: keySampleSize}); err == nil {
+		result.SampledRecords = len(page.Records)
+		for _, record := range page.Records {
+			if record.Key != nil {
+				result.KeyedRecords++
+			}
+		}
+	}
+	if result.KeyedRecords > 0 {
+		result.Warning = fmt.Sprintf("%d of the %d newest records have keys. Adding partitions changes which partition each key maps to, so records for the same key will no longer be ordered across the change.", result.KeyedRecords, result.SampledRecords)
+	}
+
+	if err := admin.CreatePartitions(topic, req.Count, req.Assignment, req.ValidateOnly); err != nil {
+		status := http.StatusInternalServerError
+		var partitionErr *sarama.TopicPartitionError
+		if errors.As(err, &partitionErr) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("Failed to add partitions to topic %s: %v", topic, err), status)
+		return
+	}
+	if !req.ValidateOnly {
+		s.kafkaConn.RefreshMetadata(topic)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// validateAssignment checks an explicit assignment for the added partitions
+// before it is sent to the controller.
+func validateAssignment(assignment [][]int32, added int32, replication int) error {
+	if assignment == nil {
+		return nil
+	}
+	if int32(len(assignment)) != added {
+		return fmt.Errorf("assignment lists %d partitions, but %d are being added", len(assignment), added)
+	}
+	for i, replicas := range assignment {
+		if len(replicas) == 0 {
+			return fmt.Errorf("assignment %d has no replicas", i)
+		}
+		if replication > 0 && len(replicas) != replication {
+			return fmt.Errorf("assignment %d has %d replicas, but the topic's replication factor is %d", i, len(replicas), replication)
+		}
+		seen := make(map[int32]bool, len(replicas))
+		for _, broker := range replicas {
+			if seen[broker] {
+				return fmt.Errorf("assignment %d lists broker %d twice", i, broker)
+			}
+			seen[broker] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// ZookeeperMetadataSource reads topic and broker layout from the legacy
+// /brokers znodes. Offsets are not stored in ZooKeeper, so they still come
+// from the Kafka client.
+type ZookeeperMetadataSource struct {
+	conn   *zk.Conn
+	client sarama.Client
+}
+
+func NewZookeeperMetadataSource(nodes []string, client sarama.Client) (*ZookeeperMetadataSource, error) {
+	conn, _, err := zk.Connect(nodes, time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZookeeperMetadataSource{
+		conn:   conn,
+		client: client,
+	}, nil
+}
+
+func (z *ZookeeperMetadataSource) ListTopics() ([]string, error) {
+	children, _, err := z.conn.Children("/brokers/topics")
+	if err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+func (z *ZookeeperMetadataSource) DescribeTopics(topics []string) ([]TopicMetadata, error) {
+	metadata := make([]TopicMetadata, 0, len(topics))
+	for _, topic := range topics {
+		data, _, err := z.conn.Get(fmt.Sprintf("/brokers/topics/%s", topic))
+		if err != nil {
+			return nil, err
+		}
+
+		var topicInfo struct {
+			Partitions map[string][]int32 `json:"partitions"`
+		}
+		if err := json.Unmarshal(data, &topicInfo); err != nil {
+			return nil, err
+		}
+
+		topicMetadata := TopicMetadata{Name: topic}
+		for id, replicas := range topicInfo.Partitions {
+			partition, err := strconv.Atoi(id)
+			if err != nil {
+				return nil, err
+			}
+
+			state, err := z.partitionState(topic, id)
+			if err != nil {
+				return nil, err
+			}
+
+			topicMetadata.Partitions = append(topicMetadata.Partitions, PartitionMetadata{
+				ID:       int32(partition),
+				Leader:   state.Leader,
+				Replicas: replicas,
+				ISR:      state.ISR,
+			})
+		}
+		sortPartitions(topicMetadata.Partitions)
+		metadata = append(metadata, topicMetadata)
+	}
+
+	return metadata, nil
+}
+
+type zkPartitionState struct {
+	Leader int32   `json:"leader"`
+	ISR    []int32 `json:"isr"`
+}
+
+func (z *ZookeeperMetadataSource) partitionState(topic, partition string) (zkPartitionState, error) {
+	data, _, err := z.conn.Get(fmt.Sprintf("/brokers/topics/%s/partitions/%s/state", topic, partition))
+	if err == zk.ErrNoNode {
+		return zkPartitionState{Leader: -1}, nil
+	}
+	if err != nil {
+		return zkPartitionState{}, err
+	}
+
+	var state zkPartitionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return zkPartitionState{}, err
+	}
+	return state, nil
+}
+
+func (z *ZookeeperMetadataSource) ListBrokers() ([]BrokerInfo, error) {
+	brokerIDs, _, err := z.conn.Children("/brokers/ids")
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	brokers := make([]BrokerInfo, len(brokerIDs))
+	errs := make(chan error, len(brokerIDs))
+
+	for i, brokerID := range brokerIDs {
+		wg.Add(1)
+		go func(i int, brokerID string) {
+			defer wg.Done()
+
+			data, _, err := z.conn.Get(fmt.Sprintf("/brokers/ids/%s", brokerID))
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			var broker struct {
+				Timestamp string   `json:"timestamp"`
+				Endpoints []string `json:"endpoints"`
+				Host      string   `json:"host"`
+				Port      int32    `json:"port"`
+				Version   int32    `json:"version"`
+				Rack      string   `json:"rack"`
+			}
+			if err := json.Unmarshal(data, &broker); err != nil {
+				errs <- err
+				return
+			}
+
+			brokers[i] = BrokerInfo{
+				ID:       int32(mustAtoi(brokerID)),
+				Hostname: broker.Host,
+				Port:     broker.Port,
+				Rack:     broker.Rack,
+			}
+		}(i, brokerID)
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+
+	sortBrokers(brokers)
+	return brokers, nil
+}
+
+func (z *ZookeeperMetadataSource) PartitionOffsets(topic string) (map[int32]PartitionOffsets, error) {
+	return clientPartitionOffsets(z.client, topic)
+}
+
+// Watch sets ZooKeeper child watches on the topic and broker lists and
+// re-arms them after every notification.
+func (z *ZookeeperMetadataSource) Watch(done <-chan struct{}) <-chan MetadataEvent {
+	events := make(chan MetadataEvent)
+
+	var wg sync.WaitGroup
+	for path, eventType := range map[string]string{
+		"/brokers/topics": MetadataEventTopics,
+		"/brokers/ids":    MetadataEventBrokers,
+	} {
+		wg.Add(1)
+		go func(path, eventType string) {
+			defer wg.Done()
+			for {
+				_, _, zkEvents, err := z.conn.ChildrenW(path)
+				if err != nil {
+					log.Println(err)
+					select {
+					case <-done:
+						return
+					case <-time.After(time.Second):
+						continue
+					}
+				}
+
+				select {
+				case event := <-zkEvents:
+					if event.Type == zk.EventNodeChildrenChanged {
+						if !sendEvent(events, done, MetadataEvent{Type: eventType}) {
+							return
+						}
+					}
+				case <-done:
+					return
+				}
+			}
+		}(path, eventType)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events
+}
+
+func (z *ZookeeperMetadataSource) Close() error {
+	z.conn.Close()
+	return nil
+}